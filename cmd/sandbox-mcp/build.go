@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// buildSandboxes builds the Docker images of the given sandboxes or all sandboxes
+// It returns a non-zero exit code if any build fails
+func buildSandboxes(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	parallel := flags.Int("parallel", 1, "Number of images that are built at the same time")
+	noCache := flags.Bool("no-cache", false, "Build without the Docker build cache, even if the images are up to date")
+	pull := flags.Bool("pull", false, "Pull newer versions of the base images, even if the images are up to date")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp build [flags] [sandbox-id...]")
+		fmt.Fprintln(flags.Output(), "\nBuild the Docker images of the given sandboxes or all sandboxes.")
+		fmt.Fprintln(flags.Output(), "Images built from an unchanged sandbox directory are skipped.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	_, configs, err := loadSandboxes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	// Build the given sandboxes or all sandboxes
+	ids := flags.Args()
+	if len(ids) == 0 {
+		for id := range configs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+	for _, id := range ids {
+		if _, ok := configs[id]; !ok {
+			fmt.Fprintf(os.Stderr, "Unknown sandbox: %s\n", id)
+			return 1
+		}
+	}
+
+	if *parallel < 1 {
+		*parallel = 1
+	}
+
+	// Stop the builds on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := sandbox.BuildOptions{NoCache: *noCache, Pull: *pull}
+
+	var (
+		wg     sync.WaitGroup
+		output sync.Mutex
+		slots  = make(chan struct{}, *parallel)
+		built  = make([]bool, len(ids))
+		errs   = make([]error, len(ids))
+	)
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			// Prefix the output with the sandbox id so that concurrent builds can be told apart
+			// Lines are written while holding a shared mutex so that they do not interleave
+			w := sandbox.NewLineWriter(func(line string) {
+				output.Lock()
+				defer output.Unlock()
+				fmt.Printf("[%s] %s\n", id, line)
+			})
+			defer w.Flush()
+
+			buildOpts := opts
+			buildOpts.Output = w
+			built[i], errs[i] = sandbox.BuildImage(ctx, configs[id], buildOpts)
+		}()
+	}
+	wg.Wait()
+
+	failed, upToDate := 0, 0
+	for i := range ids {
+		switch {
+		case errs[i] != nil:
+			failed++
+		case !built[i]:
+			upToDate++
+		}
+	}
+	fmt.Printf("\n%d built, %d up to date, %d failed\n", len(ids)-failed-upToDate, upToDate, failed)
+
+	if failed > 0 {
+		for i, id := range ids {
+			if errs[i] != nil {
+				fmt.Fprintf(os.Stderr, "Failed to build image for sandbox %s: %v\n", id, errs[i])
+			}
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// configCommand runs the subcommands of the config command
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "Usage: sandbox-mcp config show [--json]")
+		fmt.Fprintln(os.Stderr, "\nShow the effective configuration and where each value comes from.")
+		return 2
+	}
+	return showConfig(args[1:])
+}
+
+// showConfig prints the effective configuration with the origin of each value
+// The values come from the defaults, the config file, the environment variables and the flags in this order
+func showConfig(args []string) int {
+	flags := flag.NewFlagSet("config show", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the effective configuration as JSON, like a config file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp config show [--json]")
+		fmt.Fprintln(flags.Output(), "\nShow the effective configuration and where each value comes from.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load sandbox-mcp configuration: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal configuration: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return 0
+	}
+
+	fmt.Printf("Config file: %s\n\n", cfg.Path())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tORIGIN\tENV")
+	for _, value := range cfg.Values() {
+		data, err := json.Marshal(value.Value)
+		if err != nil {
+			data = []byte(fmt.Sprint(value.Value))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", value.Key, data, value.Origin, value.Env)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// doctorTimeout is the maximum time to wait for the Docker daemon to respond
+const doctorTimeout = 10 * time.Second
+
+// runDoctor checks Docker and the sandbox configurations for problems
+// It returns a non-zero exit code if any problem is found
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp doctor")
+		fmt.Fprintln(flags.Output(), "\nCheck Docker reachability, missing images and configuration errors.")
+	}
+	_ = flags.Parse(args)
+
+	problems := 0
+	ok := func(format string, a ...any) {
+		fmt.Printf("✓ "+format+"\n", a...)
+	}
+	fail := func(format string, a ...any) {
+		problems++
+		fmt.Printf("✗ "+format+"\n", a...)
+	}
+
+	// Check the configurations
+	cfg, err := loadConfig()
+	if err != nil {
+		fail("Configuration: %v", err)
+		return 1
+	}
+	ok("Configuration loaded, sandboxes path: %s", cfg.SandboxesPath)
+
+	configs, err := config.LoadSandboxPaths(cfg.SandboxesPath)
+	if err != nil {
+		fail("Sandbox configurations: %v", err)
+	} else {
+		loaded := len(configs)
+		// Unknown enabled sandboxes are likely typos that hide the sandboxes
+		for _, id := range cfg.UnknownEnabled(configs) {
+			fail("Sandbox %s in enabledSandboxes does not exist", id)
+		}
+		if configs, err = cfg.ApplyPolicy(configs); err != nil {
+			fail("Sandbox policy: %v", err)
+		} else {
+			ok("Loaded %d sandbox configurations, %d enabled", loaded, len(configs))
+		}
+	}
+
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if err := configs[id].Validate(); err != nil {
+			fail("Sandbox %s has an invalid configuration:\n    %s", id, strings.ReplaceAll(err.Error(), "\n", "\n    "))
+		}
+	}
+
+	// Check that Docker is reachable
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	cli, err := sandbox.NewDockerClient()
+	if err != nil {
+		fail("Docker: %v", err)
+		return 1
+	}
+	defer cli.Close()
+
+	serverVersion, err := cli.ServerVersion(ctx)
+	if err != nil {
+		fail("Docker is not reachable: %v", err)
+		return 1
+	}
+	ok("Docker %s is reachable (API version %s, client API version %s)", serverVersion.Version, serverVersion.APIVersion, cli.ClientVersion())
+
+	// Check that the images of the sandboxes are built
+	missing := 0
+	for _, id := range ids {
+		for _, image := range configs[id].Images() {
+			exists, err := sandbox.ImageExists(ctx, cli, image)
+			if err != nil {
+				fail("Sandbox %s: %v", id, err)
+				continue
+			}
+			if !exists {
+				missing++
+				fail("Sandbox %s: image %s is missing", id, image)
+			}
+		}
+	}
+	if missing > 0 {
+		fmt.Println("\nRun 'sandbox-mcp build' to build the missing images.")
+	} else if len(ids) > 0 {
+		ok("All sandbox images are built")
+	}
+
+	if problems > 0 {
+		fmt.Printf("\n%d problems found\n", problems)
+		return 1
+	}
+	fmt.Println("\nNo problems found")
+	return 0
+}
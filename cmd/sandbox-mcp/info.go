@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// showInfo prints the tool description and input schema of a sandbox as the MCP clients see them
+func showInfo(args []string) int {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp info <sandbox-id>")
+		fmt.Fprintln(flags.Output(), "\nShow the description and tool schema of a sandbox.")
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	_, configs, err := loadSandboxes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	sandboxCfg, ok := configs[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown sandbox: %s\n", flags.Arg(0))
+		return 1
+	}
+
+	tool := sandbox.NewSandboxTool(sandboxCfg)
+	schema, err := json.MarshalIndent(tool.InputSchema, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render tool schema: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Tool:    %s\n", tool.Name)
+	fmt.Printf("Name:    %s\n", sandboxCfg.Name())
+	fmt.Printf("Version: %s\n", sandboxCfg.Version)
+	fmt.Printf("Images:  %s\n", strings.Join(sandboxCfg.Images(), ", "))
+	fmt.Printf("Path:    %s\n", sandboxCfg.Dir)
+	fmt.Printf("\nDescription:\n%s\n", tool.Description)
+	fmt.Printf("\nInput schema:\n%s\n", schema)
+	return 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/docker/client"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// listSandboxes prints a table of the sandboxes, their images, whether the images are built
+// and the sandboxes directories they come from
+func listSandboxes(args []string) int {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp list")
+		fmt.Fprintln(flags.Output(), "\nList the sandboxes, their images, whether the images are built and where the sandboxes come from.")
+	}
+	_ = flags.Parse(args)
+
+	_, configs, err := loadSandboxes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	// The table is still printed without Docker, only without the build status
+	cli, err := sandbox.NewDockerClient()
+	if err == nil {
+		defer cli.Close()
+		_, err = cli.Ping(context.Background())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Docker is not available, cannot check the images: %v\n\n", err)
+		cli = nil
+	}
+
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tIMAGE\tBUILT\tORIGIN")
+	for _, id := range ids {
+		sandboxCfg := configs[id]
+		// The origin is the sandboxes directory the sandbox was loaded from
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", id, strings.Join(sandboxCfg.Images(), ", "), builtStatus(cli, sandboxCfg), filepath.Dir(sandboxCfg.Dir))
+	}
+	w.Flush()
+
+	return 0
+}
+
+// builtStatus returns whether the images of a sandbox are available locally
+func builtStatus(cli *client.Client, sandboxCfg *config.SandboxConfig) string {
+	if cli == nil {
+		return "unknown"
+	}
+
+	images := sandboxCfg.Images()
+	built := 0
+	for _, image := range images {
+		exists, err := sandbox.ImageExists(context.Background(), cli, image)
+		if err != nil {
+			return "unknown"
+		}
+		if exists {
+			built++
+		}
+	}
+
+	switch built {
+	case len(images):
+		return "yes"
+	case 0:
+		return "no"
+	default:
+		return fmt.Sprintf("partial (%d/%d)", built, len(images))
+	}
+}
@@ -1,91 +1,157 @@
 package main
 
 import (
-	"context"
 	"flag"
-	"log"
+	"fmt"
+	"os"
 
-	"github.com/mark3labs/mcp-go/server"
 	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
 	"github.com/pottekkat/sandbox-mcp/internal/config"
-	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+	"github.com/pottekkat/sandbox-mcp/internal/logging"
+)
+
+// command is a subcommand of sandbox-mcp
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+// commands are the available subcommands in the order they are shown in the usage
+var commands = []command{
+	{"serve", "Start the MCP server via stdio transport", serve},
+	{"run", "Run a sandbox from the terminal", runSandbox},
+	{"test", "Run the test cases of the sandboxes", testSandboxes},
+	{"build", "Build the Docker images of the sandboxes", buildSandboxes},
+	{"pull", "Pull sandboxes from GitHub or the configured sources", pullSandboxes},
+	{"update", "Update the installed sandboxes from their sources", updateSandboxes},
+	{"new", "Create a new sandbox from a template", newSandbox},
+	{"validate", "Check the configurations and test cases of the sandboxes", validateSandboxes},
+	{"list", "List the sandboxes and whether their images are built", listSandboxes},
+	{"info", "Show the description and tool schema of a sandbox", showInfo},
+	{"doctor", "Check Docker and the sandbox configurations for problems", runDoctor},
+	{"config", "Show the effective configuration", configCommand},
+	{"version", "Print the version of sandbox-mcp", printVersion},
+}
+
+// Global flags that apply to all commands
+var (
+	// globalFlags are shown in the usage
+	globalFlags = flag.NewFlagSet("sandbox-mcp", flag.ExitOnError)
+	// configFlag is the path of the config file
+	configFlag string
+	// readOnlyFlag never writes to disk
+	readOnlyFlag bool
+	// strictFlag fails on unknown sandboxes in the enabled sandboxes
+	strictFlag bool
+	// sandboxesFlag overrides the sandboxes paths of the configuration
+	sandboxesFlag string
 )
 
 func main() {
-	// Parse flags
-	stdio := flag.Bool("stdio", false, "Start the MCP via stdio transport")
-	build := flag.Bool("build", false, "Build Docker images for all sandboxes")
-	pull := flag.Bool("pull", false, "Pull default sandboxes from GitHub")
-	force := flag.Bool("force", false, "Force overwrite existing sandboxes when pulling")
-	flag.Parse()
-
-	// Configure logging
-	// TODO: Improve logging as per MCP spec
-	log.SetPrefix("[Sandbox MCP] ")
-	log.SetFlags(log.Ldate | log.Ltime)
+	var logOpts logging.Options
+	flags := globalFlags
+	flags.StringVar(&configFlag, "config", "", "Path of the config file, defaults to $SANDBOX_MCP_CONFIG or $XDG_CONFIG_HOME/sandbox-mcp/config.json")
+	flags.BoolVar(&readOnlyFlag, "read-only", false, "Never write to disk, like the default config file or pulled sandboxes")
+	flags.BoolVar(&strictFlag, "strict", false, "Fail on unknown sandboxes in enabledSandboxes instead of ignoring them")
+	flags.StringVar(&sandboxesFlag, "sandboxes", "", fmt.Sprintf("Sandboxes directories in order of precedence, separated by '%c'", os.PathListSeparator))
+	flags.StringVar(&logOpts.Level, "log-level", "info", "Minimum level of the logs: debug, info, warn or error")
+	flags.StringVar(&logOpts.Format, "log-format", logging.FormatText, "Format of the logs: text or json")
+	flags.StringVar(&logOpts.File, "log-file", "", "Append the logs to a file instead of stderr")
+	// Support the flags used before the subcommands were added
+	// so that existing MCP client configurations keep working
+	stdio := flags.Bool("stdio", false, "Start the MCP via stdio transport (same as serve)")
+	build := flags.Bool("build", false, "Build Docker images for all sandboxes (same as build)")
+	pull := flags.Bool("pull", false, "Pull default sandboxes from GitHub (same as pull)")
+	force := flags.Bool("force", false, "Force overwrite existing sandboxes when pulling")
+	flags.Usage = usage
+	_ = flags.Parse(os.Args[1:])
 
-	// Load application configuration
-	cfg, err := appconfig.LoadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load sandbox-mcp configuration: %v", err)
+	// Configure logging before anything is logged
+	// MCP clients can also receive the logs by setting a log level
+	if err := logging.Setup(logOpts); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
 	}
 
-	// Pull sandboxes if pull flag is present
-	if *pull {
-		if err := sandbox.PullSandboxes(cfg.SandboxesPath, *force); err != nil {
-			log.Fatalf("Failed to pull sandboxes: %v", err)
+	if flags.NArg() == 0 {
+		switch {
+		case *pull:
+			var pullArgs []string
+			if *force {
+				pullArgs = append(pullArgs, "--force")
+			}
+			os.Exit(pullSandboxes(pullArgs))
+		case *build:
+			os.Exit(buildSandboxes(nil))
+		case *stdio:
+			os.Exit(serve(nil))
 		}
-		return
+		usage()
+		os.Exit(2)
 	}
 
-	// Load sandbox configurations from the configured path
-	configs, err := config.LoadSandboxConfigs(cfg.SandboxesPath)
-	if err != nil {
-		log.Fatalf("Failed to load sandbox configurations: %v", err)
+	name := flags.Arg(0)
+	if name == "help" {
+		usage()
+		return
 	}
 
-	// Build Docker images if build flag is present
-	if *build {
-		log.Println("Building Docker images for all sandboxes...")
-		for _, sandboxCfg := range configs {
-			if err := sandbox.BuildImage(context.Background(), sandboxCfg, cfg.SandboxesPath); err != nil {
-				log.Printf("Failed to build image for sandbox %s: %v", sandboxCfg.Id, err)
-				continue
-			}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(flags.Args()[1:]))
 		}
-		return
 	}
 
-	// Only start MCP server if the stdio flag is present
-	if *stdio {
-		// Create a new MCP server
-		s := server.NewMCPServer(
-			"Sandbox MCP",
-			"0.1.0",
-			// We don't notify when the list of tools changes
-			// The list of tools never change for now
-			server.WithToolCapabilities(false),
-		)
-
-		// Create and add tools for each sandbox configuration
-		for _, cfg := range configs {
-			// Create a new tool from the config
-			tool := sandbox.NewSandboxTool(cfg)
-
-			// Create a handler using the sandbox config
-			handler := sandbox.NewSandboxToolHandler(cfg)
-
-			// Add the tool to the server
-			s.AddTool(tool, handler)
-
-			log.Printf("Added %s tool from config", cfg.Id)
-		}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-		log.Println("Starting Sandbox MCP server...")
+// usage prints the available subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: sandbox-mcp [global flags] <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nGlobal flags:")
+	globalFlags.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nRun 'sandbox-mcp <command> --help' for the flags of a command.")
+}
 
-		// Start the server
-		if err := server.ServeStdio(s); err != nil {
-			log.Printf("Error starting server: %v\n", err)
-		}
+// loadConfig loads the application configuration and applies the global flags
+func loadConfig() (*appconfig.Config, error) {
+	cfg, err := appconfig.Load(appconfig.LoadOptions{Path: configFlag, ReadOnly: readOnlyFlag, Strict: strictFlag})
+	if err != nil {
+		return nil, err
+	}
+	if paths := appconfig.ParsePaths(sandboxesFlag); len(paths) > 0 {
+		cfg.SandboxesPath = paths
+		cfg.SetOrigin("sandboxesPath", "flag --sandboxes")
+	}
+	return cfg, nil
+}
+
+// loadSandboxes loads the application configuration and the sandbox configurations
+func loadSandboxes() (*appconfig.Config, map[string]*config.SandboxConfig, error) {
+	// Load application configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sandbox-mcp configuration: %v", err)
+	}
+
+	// Load sandbox configurations from the configured paths
+	configs, err := config.LoadSandboxPaths(cfg.SandboxesPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sandbox configurations: %v", err)
 	}
+
+	// Apply the enabled sandboxes, overrides and limits of the application configuration
+	configs, err = cfg.ApplyPolicy(configs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply sandbox policy: %v", err)
+	}
+
+	return cfg, configs, nil
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useConfig points the global flags to an empty config file and the sandboxes of the repository
+func useConfig(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configFlag, readOnlyFlag, sandboxesFlag = path, true, "../../sandboxes"
+	t.Cleanup(func() {
+		configFlag, readOnlyFlag, sandboxesFlag = "", false, ""
+	})
+}
+
+func TestCommands(t *testing.T) {
+	names := make(map[string]bool)
+	for _, cmd := range commands {
+		if names[cmd.name] {
+			t.Errorf("duplicate command %s", cmd.name)
+		}
+		names[cmd.name] = true
+		if cmd.description == "" || cmd.run == nil {
+			t.Errorf("command %s needs a description and a run function", cmd.name)
+		}
+	}
+	if names["help"] {
+		t.Error("help is handled before the commands and cannot be a command")
+	}
+}
+
+func TestLoadSandboxes(t *testing.T) {
+	useConfig(t)
+
+	cfg, configs, err := loadSandboxes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.SandboxesPath) != 1 || cfg.SandboxesPath[0] != "../../sandboxes" {
+		t.Errorf("expected the sandboxes path of the flag, got %v", cfg.SandboxesPath)
+	}
+	for _, value := range cfg.Values() {
+		if value.Key == "sandboxesPath" && value.Origin != "flag --sandboxes" {
+			t.Errorf("expected the flag as origin of the sandboxes path, got %q", value.Origin)
+		}
+	}
+	if _, ok := configs["shell"]; !ok {
+		t.Errorf("expected the shell sandbox, got %d sandboxes", len(configs))
+	}
+}
+
+func TestShowInfo(t *testing.T) {
+	useConfig(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+	}{
+		{"sandbox", []string{"shell"}, 0},
+		{"unknown sandbox", []string{"ruby"}, 1},
+		{"without sandbox", nil, 2},
+		{"several sandboxes", []string{"shell", "python"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if exitCode := showInfo(tt.args); exitCode != tt.exitCode {
+				t.Errorf("expected exit code %d, got %d", tt.exitCode, exitCode)
+			}
+		})
+	}
+}
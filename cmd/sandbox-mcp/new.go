@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pottekkat/sandbox-mcp/internal/scaffold"
+)
+
+// newSandbox creates a new sandbox from a template and validates it
+func newSandbox(args []string) int {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	from := flags.String("from", scaffold.DefaultTemplate, fmt.Sprintf("Template to create the sandbox from: %s", strings.Join(scaffold.Templates(), ", ")))
+	name := flags.String("name", "", "Name of the sandbox shown to MCP clients, defaults to the id")
+	dir := flags.String("dir", "", "Directory to create the sandbox in, defaults to the first sandboxes directory")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp new [flags] <sandbox-id>")
+		fmt.Fprintln(flags.Output(), "\nCreate a new sandbox with a Dockerfile, a config.json with secure defaults and a sample test case.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	id := flags.Arg(0)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load sandbox-mcp configuration: %v\n", err)
+		return 1
+	}
+	if err := cfg.CheckWritable(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *dir == "" {
+		*dir = cfg.SandboxesPath.Primary()
+	}
+	sandboxDir := filepath.Join(*dir, id)
+
+	if err := scaffold.Create(sandboxDir, *from, scaffold.Data{Id: id, Name: *name}); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create sandbox: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Created sandbox %s from the %s template in %s\n\n", id, *from, sandboxDir)
+
+	if !validateSandbox(sandboxDir) {
+		return 1
+	}
+
+	fmt.Printf("\nNext, edit the Dockerfile and config.json, then run:\n")
+	fmt.Printf("  sandbox-mcp build %s\n", id)
+	fmt.Printf("  sandbox-mcp test %s\n", id)
+	return 0
+}
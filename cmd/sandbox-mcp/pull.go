@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// pullSandboxes installs sandboxes into the sandboxes directory from the given source,
+// the configured sources or the GitHub release of the current version
+func pullSandboxes(args []string) int {
+	flags := flag.NewFlagSet("pull", flag.ExitOnError)
+	force := flags.Bool("force", false, "Force overwrite existing sandboxes")
+	insecure := flags.Bool("insecure", false, "Install releases without verifying their signed checksums")
+	from := flags.String("from", "", "Pull from a tar.gz archive URL or path, or a directory instead of the configured sources")
+	sha := flags.String("sha256", "", "Expected SHA-256 checksum of the archive given with --from")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp pull [flags] [sandbox-id...]")
+		fmt.Fprintln(flags.Output(), "\nPull the given sandboxes or all sandboxes from the configured sources.")
+		fmt.Fprintln(flags.Output(), "Defaults to the sandboxes of the GitHub release of this version.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	// Load application configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load sandbox-mcp configuration: %v\n", err)
+		return 1
+	}
+	if err := cfg.CheckWritable(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	sources := cfg.Sources
+	if *from != "" {
+		sources = []appconfig.Source{{URL: *from, SHA256: *sha}}
+	}
+	if len(sources) == 0 {
+		sources = []appconfig.Source{{URL: appconfig.SourceRelease}}
+	}
+
+	opts := sandbox.PullOptions{Force: *force, Sandboxes: flags.Args(), Insecure: *insecure}
+	failed := false
+	for _, source := range sources {
+		if err := sandbox.PullSource(cfg.SandboxesPath.Primary(), source, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to pull sandboxes from %s: %v\n", source.Describe(), err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// runSandbox runs a sandbox from the terminal and returns the exit code of the command
+// It goes through the same handler that the MCP server uses for tool calls
+func runSandbox(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	entrypoint := flags.String("entrypoint", "", "File with the entrypoint code (defaults to a file named like the entrypoint, or stdin)")
+	variants := flags.String("variants", "", "Comma-separated list of variants to run on for sandboxes with a matrix")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp run [flags] <sandbox-id> [files...]")
+		fmt.Fprintln(flags.Output(), "\nRun a sandbox with the given files and print its output.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, configs, err := loadSandboxes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	sandboxConfig, ok := configs[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown sandbox: %s\n", flags.Arg(0))
+		return 1
+	}
+
+	arguments, err := runArguments(sandboxConfig, *entrypoint, flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if selected := variantArguments(*variants); len(selected) > 0 {
+		arguments["variants"] = selected
+	}
+
+	// Stop the sandbox and clean up on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = sandboxConfig.Id
+	request.Params.Arguments = arguments
+
+	result, err := sandbox.NewSandboxToolHandler(sandboxConfig, sandbox.WithImagePolicy(cfg.ImagePolicy))(ctx, request)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run sandbox %s: %v\n", sandboxConfig.Id, err)
+		return 1
+	}
+
+	// Print the output to stdout, or to stderr if the command failed
+	output := os.Stdout
+	if result.IsError {
+		output = os.Stderr
+	}
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			fmt.Fprint(output, text.Text)
+			if !strings.HasSuffix(text.Text, "\n") {
+				fmt.Fprintln(output)
+			}
+		}
+	}
+
+	exitCode := sandbox.ExitCode(result)
+	fmt.Fprintf(os.Stderr, "Exit code: %d\n", exitCode)
+	return exitCode
+}
+
+// runArguments creates the tool call arguments from the files passed on the command line
+// Files named like the entrypoint or a required file of the sandbox are passed as such
+// and the rest are passed as additional files
+func runArguments(sandboxConfig *config.SandboxConfig, entrypoint string, paths []string) (map[string]any, error) {
+	arguments := make(map[string]any)
+	var additionalFiles []any
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %v", err)
+		}
+		name := filepath.Base(path)
+
+		if name == sandboxConfig.Entrypoint && entrypoint == "" {
+			arguments[sandboxConfig.ParamEntrypoint()] = string(data)
+			continue
+		}
+		if file, ok := requiredFile(sandboxConfig, name); ok {
+			arguments[file.ParamName()] = string(data)
+			continue
+		}
+		if !sandboxConfig.Parameters.AdditionalFiles {
+			return nil, fmt.Errorf("sandbox %s does not accept the additional file %s", sandboxConfig.Id, name)
+		}
+		additionalFiles = append(additionalFiles, map[string]any{
+			"filename": name,
+			"content":  string(data),
+		})
+	}
+
+	if len(additionalFiles) > 0 {
+		arguments["files"] = additionalFiles
+	}
+
+	// Read the entrypoint from the flag or stdin if it was not passed as a file
+	if _, ok := arguments[sandboxConfig.ParamEntrypoint()]; !ok {
+		var data []byte
+		var err error
+		if entrypoint == "" || entrypoint == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(entrypoint)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read entrypoint: %v", err)
+		}
+		arguments[sandboxConfig.ParamEntrypoint()] = string(data)
+	}
+
+	return arguments, nil
+}
+
+// variantArguments returns the variants of a comma-separated list as tool call arguments
+func variantArguments(variants string) []any {
+	var selected []any
+	for _, variant := range strings.Split(variants, ",") {
+		if variant = strings.TrimSpace(variant); variant != "" {
+			selected = append(selected, variant)
+		}
+	}
+	return selected
+}
+
+// requiredFile returns the required file of a sandbox with the given name
+func requiredFile(sandboxConfig *config.SandboxConfig, name string) (config.SandboxFile, bool) {
+	for _, file := range sandboxConfig.Parameters.Files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return config.SandboxFile{}, false
+}
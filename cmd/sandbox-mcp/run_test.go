@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// newRunConfig creates a sandbox with an entrypoint and a required file
+func newRunConfig(additionalFiles bool) *config.SandboxConfig {
+	return &config.SandboxConfig{
+		Id:         "python",
+		Entrypoint: "main.py",
+		Parameters: config.SandboxParameters{
+			AdditionalFiles: additionalFiles,
+			Files:           []config.SandboxFile{{Name: "requirements.txt"}},
+		},
+	}
+}
+
+// writeRunFiles writes the files to a temporary directory and returns their paths by name
+func writeRunFiles(t *testing.T, files map[string]string) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make(map[string]string, len(files))
+	for name, content := range files {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestRunArguments(t *testing.T) {
+	paths := writeRunFiles(t, map[string]string{
+		"main.py":          "print('main')",
+		"other.py":         "print('other')",
+		"requirements.txt": "requests",
+		"helper.py":        "x = 1",
+	})
+
+	tests := []struct {
+		name            string
+		additionalFiles bool
+		entrypoint      string
+		files           []string
+		expected        map[string]any
+		err             string
+	}{
+		{
+			name:     "entrypoint file",
+			files:    []string{"main.py"},
+			expected: map[string]any{"main_py": "print('main')"},
+		},
+		{
+			name:     "required file",
+			files:    []string{"main.py", "requirements.txt"},
+			expected: map[string]any{"main_py": "print('main')", "requirements_txt": "requests"},
+		},
+		{
+			name:       "entrypoint flag",
+			entrypoint: "other.py",
+			files:      []string{"requirements.txt"},
+			expected:   map[string]any{"main_py": "print('other')", "requirements_txt": "requests"},
+		},
+		{
+			name:            "entrypoint flag with a file named like the entrypoint",
+			additionalFiles: true,
+			entrypoint:      "other.py",
+			files:           []string{"main.py"},
+			expected: map[string]any{
+				"main_py": "print('other')",
+				"files":   []any{map[string]any{"filename": "main.py", "content": "print('main')"}},
+			},
+		},
+		{
+			name:            "additional files",
+			additionalFiles: true,
+			files:           []string{"main.py", "helper.py"},
+			expected: map[string]any{
+				"main_py": "print('main')",
+				"files":   []any{map[string]any{"filename": "helper.py", "content": "x = 1"}},
+			},
+		},
+		{
+			name:  "additional file not accepted",
+			files: []string{"main.py", "helper.py"},
+			err:   "does not accept the additional file helper.py",
+		},
+		{
+			name:  "missing file",
+			files: []string{"missing.py"},
+			err:   "failed to read file",
+		},
+		{
+			name:       "missing entrypoint",
+			entrypoint: "missing.py",
+			err:        "failed to read entrypoint",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			for _, name := range tt.files {
+				path, ok := paths[name]
+				if !ok {
+					path = filepath.Join(t.TempDir(), name)
+				}
+				files = append(files, path)
+			}
+			entrypoint := tt.entrypoint
+			if path, ok := paths[entrypoint]; ok {
+				entrypoint = path
+			}
+
+			arguments, err := runArguments(newRunConfig(tt.additionalFiles), entrypoint, files)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error with %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(arguments, tt.expected) {
+				t.Errorf("expected arguments %v, got %v", tt.expected, arguments)
+			}
+		})
+	}
+}
+
+func TestRunArgumentsReadsStdin(t *testing.T) {
+	paths := writeRunFiles(t, map[string]string{"stdin": "print('stdin')"})
+	stdin, err := os.Open(paths["stdin"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	original := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = original }()
+
+	// The entrypoint is read from stdin if it is not a file or the flag is -
+	arguments, err := runArguments(newRunConfig(false), "-", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if arguments["main_py"] != "print('stdin')" {
+		t.Errorf("expected the entrypoint from stdin, got %v", arguments)
+	}
+}
+
+func TestVariantArguments(t *testing.T) {
+	tests := map[string][]any{
+		"":              nil,
+		"3.12":          {"3.12"},
+		"3.12,3.13":     {"3.12", "3.13"},
+		" 3.12 , 3.13 ": {"3.12", "3.13"},
+		"3.12,,":        {"3.12"},
+	}
+	for value, expected := range tests {
+		if selected := variantArguments(value); !reflect.DeepEqual(selected, expected) {
+			t.Errorf("expected variants %v for %q, got %v", expected, value, selected)
+		}
+	}
+}
+
+func TestRequiredFile(t *testing.T) {
+	sandboxConfig := newRunConfig(false)
+	if file, ok := requiredFile(sandboxConfig, "requirements.txt"); !ok || file.ParamName() != "requirements_txt" {
+		t.Errorf("expected the required file, got %+v, %v", file, ok)
+	}
+	for _, name := range []string{"main.py", "other.txt", ""} {
+		if _, ok := requiredFile(sandboxConfig, name); ok {
+			t.Errorf("expected %q not to be a required file", name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pottekkat/sandbox-mcp/internal/mcpserver"
+	"github.com/pottekkat/sandbox-mcp/internal/metrics"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// serve starts the MCP server via stdio transport
+func serve(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	metricsAddr := flags.String("metrics-addr", "", "Serve Prometheus metrics on /metrics at the address, like localhost:9090")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp serve [flags]")
+		fmt.Fprintln(flags.Output(), "\nStart the MCP server via stdio transport.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	cfg, configs, err := loadSandboxes()
+	if err != nil {
+		slog.Error("Failed to start server", "error", err)
+		return 1
+	}
+
+	// Serve the metrics of the sandbox executions
+	if *metricsAddr != "" {
+		if err := metrics.Serve(*metricsAddr); err != nil {
+			slog.Error("Failed to serve metrics", "error", err)
+			return 1
+		}
+	}
+
+	// Limit the number of sandboxes running at the same time
+	sandbox.SetMaxConcurrency(cfg.MaxConcurrency)
+
+	// Check the images of the sandboxes and build or pull the missing ones
+	// in the background so that the server starts right away
+	go sandbox.EnsureImages(context.Background(), configs, sandbox.WithImagePolicy(cfg.ImagePolicy))
+
+	// Create a new MCP server with the sandboxes
+	s := mcpserver.New(cfg, configs)
+
+	slog.Info("Starting Sandbox MCP server", "sandboxes", len(configs))
+
+	// Start the server
+	if err := server.ServeStdio(s); err != nil {
+		slog.Error("Failed to serve", "error", err)
+		return 1
+	}
+	return 0
+}
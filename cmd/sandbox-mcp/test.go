@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/mcpserver"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+	"github.com/pottekkat/sandbox-mcp/internal/testrunner"
+)
+
+// testSandboxes runs the test cases in the tests directory of the sandboxes against the built images
+// It returns a non-zero exit code if any test case fails
+func testSandboxes(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	parallel := flags.Int("parallel", 4, "Number of test cases that run at the same time")
+	junit := flags.String("junit", "", "Write a JUnit XML report to this file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp test [flags] [sandbox-id]")
+		fmt.Fprintln(flags.Output(), "\nRun the test cases in the tests directory of all sandboxes or a single sandbox.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	cfg, configs, err := loadSandboxes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	id := flags.Arg(0)
+	if _, ok := configs[id]; id != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Unknown sandbox: %s\n", id)
+		return 1
+	}
+
+	suites, err := testrunner.LoadSandboxSuites(configs, id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load test cases: %v\n", err)
+		return 1
+	}
+	if len(suites) == 0 {
+		fmt.Fprintln(os.Stderr, "No test cases found")
+		return 0
+	}
+
+	// Stop the sandboxes and clean up on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Limit the number of sandboxes running at the same time like the server
+	sandbox.SetMaxConcurrency(cfg.MaxConcurrency)
+
+	// Call the sandbox tools in-process the same way as MCP clients do
+	// The test cases call the sandbox tools, whatever the tool mode of the server is
+	serverCfg := *cfg
+	serverCfg.ToolMode = appconfig.ToolModeSandbox
+	s := mcpserver.New(&serverCfg, configs)
+	runner, err := testrunner.NewInProcessRunner(ctx, s, *parallel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create test runner: %v\n", err)
+		return 1
+	}
+
+	results, err := runner.Run(ctx, suites)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run tests: %v\n", err)
+		return 1
+	}
+
+	failed := reportResults(os.Stdout, results)
+
+	if *junit != "" {
+		file, err := os.Create(*junit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create JUnit report: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+
+		if err := testrunner.WriteJUnit(file, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write JUnit report: %v\n", err)
+			return 1
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// reportResults prints the result of each test case and a summary and returns the number of failed test cases
+func reportResults(w io.Writer, results []testrunner.Result) int {
+	failed := 0
+	for _, result := range results {
+		name := fmt.Sprintf("%s/%s: %s", result.Suite, filepath.Base(result.File), result.Name())
+		switch {
+		case result.Skipped != "":
+			fmt.Fprintf(w, "- %s (skipped: %s)\n", name, result.Skipped)
+		case result.Passed():
+			fmt.Fprintf(w, "✓ %s (%.1fs)\n", name, result.Duration.Seconds())
+		default:
+			failed++
+			fmt.Fprintf(w, "✗ %s (%.1fs)\n", name, result.Duration.Seconds())
+			for _, failure := range result.Failures {
+				fmt.Fprintf(w, "    %s\n", failure)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d passed, %d failed, %d total\n", len(results)-failed-countSkipped(results), failed, len(results))
+	return failed
+}
+
+// countSkipped returns the number of skipped test cases
+func countSkipped(results []testrunner.Result) int {
+	skipped := 0
+	for _, result := range results {
+		if result.Skipped != "" {
+			skipped++
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pottekkat/sandbox-mcp/internal/testrunner"
+)
+
+func TestReportResults(t *testing.T) {
+	passed := testrunner.Result{Suite: "shell", File: "/sandboxes/shell/tests/cases.yaml", Index: 0, Case: testrunner.Case{Name: "echo"}, Duration: 1500 * time.Millisecond}
+	failed := testrunner.Result{Suite: "shell", File: "/sandboxes/shell/tests/cases.yaml", Index: 1, Failures: []string{"expected exit code 0, got 1"}}
+	skipped := testrunner.Result{Suite: "python", File: "/sandboxes/python/tests/cases.yaml", Index: 0, Skipped: "variant 3.14 is not built"}
+
+	tests := []struct {
+		name     string
+		results  []testrunner.Result
+		failed   int
+		expected []string
+	}{
+		{"no results", nil, 0, []string{"0 passed, 0 failed, 0 total"}},
+		{"passed", []testrunner.Result{passed}, 0, []string{"✓ shell/cases.yaml: echo (1.5s)", "1 passed, 0 failed, 1 total"}},
+		{"failed", []testrunner.Result{passed, failed}, 1, []string{"✗ shell/cases.yaml: case 2 (0.0s)", "    expected exit code 0, got 1", "1 passed, 1 failed, 2 total"}},
+		{"skipped", []testrunner.Result{passed, skipped}, 0, []string{"- python/cases.yaml: case 1 (skipped: variant 3.14 is not built)", "1 passed, 0 failed, 2 total"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			if failed := reportResults(&output, tt.results); failed != tt.failed {
+				t.Errorf("expected %d failed, got %d", tt.failed, failed)
+			}
+			for _, line := range tt.expected {
+				if !strings.Contains(output.String(), line+"\n") {
+					t.Errorf("expected %q in the output, got:\n%s", line, output.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCountSkipped(t *testing.T) {
+	results := []testrunner.Result{{}, {Skipped: "no image"}, {Failures: []string{"failed"}}, {Skipped: "no variant"}}
+	if skipped := countSkipped(results); skipped != 2 {
+		t.Errorf("expected 2 skipped, got %d", skipped)
+	}
+	if skipped := countSkipped(nil); skipped != 0 {
+		t.Errorf("expected 0 skipped, got %d", skipped)
+	}
+}
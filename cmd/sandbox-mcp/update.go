@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// Strategies for sandboxes that changed both upstream and locally
+const (
+	strategyAsk       = "ask"
+	strategyKeep      = "keep"
+	strategyOverwrite = "overwrite"
+	strategyMerge     = "merge"
+)
+
+// updateSandboxes updates the installed sandboxes from their sources
+// Sandboxes without local modifications are updated, and the others are kept,
+// overwritten or merged depending on the strategy
+func updateSandboxes(args []string) int {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	from := flags.String("from", "", "Update from a tar.gz archive URL or path, or a directory instead of the configured sources")
+	strategy := flags.String("strategy", strategyAsk, "What to do with locally modified sandboxes that changed upstream: ask, keep, overwrite or merge")
+	dryRun := flags.Bool("dry-run", false, "Only show which sandboxes changed upstream")
+	insecure := flags.Bool("insecure", false, "Fetch releases without verifying their signed checksums")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp update [flags] [sandbox-id...]")
+		fmt.Fprintln(flags.Output(), "\nUpdate the given sandboxes or all installed sandboxes from the configured sources.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	switch *strategy {
+	case strategyAsk, strategyKeep, strategyOverwrite, strategyMerge:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown strategy: %s\n", *strategy)
+		return 2
+	}
+
+	// Load application configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load sandbox-mcp configuration: %v\n", err)
+		return 1
+	}
+	if !*dryRun {
+		if err := cfg.CheckWritable(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	sources := cfg.Sources
+	if *from != "" {
+		sources = []appconfig.Source{{URL: *from}}
+	}
+	if len(sources) == 0 {
+		sources = []appconfig.Source{{URL: appconfig.SourceRelease}}
+	}
+
+	// Only ask if there is someone to answer
+	if *strategy == strategyAsk && !isTerminal(os.Stdin) {
+		*strategy = strategyKeep
+	}
+	input := bufio.NewReader(os.Stdin)
+
+	// Each sandbox is updated from the source it was installed from, or with --from from the given source
+	// Sandboxes without a recorded source are updated from the first source that has them
+	opts := sandbox.UpdateOptions{Sandboxes: flags.Args(), AnySource: *from != "", Insecure: *insecure}
+	planned := make(map[string]bool)
+
+	failed := false
+	for _, source := range sources {
+		plan, err := sandbox.PlanUpdate(cfg.SandboxesPath.Primary(), source, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to check for updates from %s: %v\n", source.Describe(), err)
+			failed = true
+			continue
+		}
+
+		for _, update := range plan.Updates {
+			if planned[update.Id] {
+				continue
+			}
+			planned[update.Id] = true
+			if err := applyUpdate(plan, update, *strategy, *dryRun, input); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to update sandbox %s: %v\n", update.Id, err)
+				failed = true
+			}
+		}
+
+		// The sandboxes may rely on the defaults file of the source
+		defaults, err := plan.UpdateDefaults(*dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update the defaults file from %s: %v\n", source.Describe(), err)
+			failed = true
+		}
+		for _, change := range defaults {
+			switch {
+			case change.Status == "M":
+				fmt.Printf("%s: changed upstream, kept local version\n", change.Path)
+			case *dryRun:
+				fmt.Printf("%s: added upstream\n", change.Path)
+			default:
+				fmt.Printf("%s: installed\n", change.Path)
+			}
+		}
+		plan.Close()
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// applyUpdate prints the changes of a sandbox and updates it according to the strategy
+func applyUpdate(plan *sandbox.UpdatePlan, update sandbox.SandboxUpdate, strategy string, dryRun bool, input *bufio.Reader) error {
+	switch {
+	case !update.Installed:
+		fmt.Printf("%s: not installed, run 'sandbox-mcp pull %s' to install it\n", update.Id, update.Id)
+		return nil
+	case !update.Changed && update.Modified:
+		fmt.Printf("%s: up to date (%s), modified locally\n", update.Id, update.LocalVersion)
+		return nil
+	case !update.Changed:
+		fmt.Printf("%s: up to date (%s)\n", update.Id, update.LocalVersion)
+		return nil
+	}
+
+	fmt.Printf("%s: %s -> %s", update.Id, versionOrUnknown(update.LocalVersion), versionOrUnknown(update.UpstreamVersion))
+	if update.Modified {
+		fmt.Print(", modified locally")
+	}
+	fmt.Println()
+	for _, file := range update.Files {
+		fmt.Printf("    %s %s\n", file.Status, file.Path)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	// Update sandboxes without local modifications right away
+	if !update.Modified {
+		strategy = strategyOverwrite
+	}
+	for strategy == strategyAsk {
+		fmt.Printf("Keep local version, overwrite with upstream, merge, or show diff? [k/o/m/d] ")
+		answer, err := input.ReadString('\n')
+		if err != nil {
+			strategy = strategyKeep
+			break
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "k", "keep":
+			strategy = strategyKeep
+		case "o", "overwrite":
+			strategy = strategyOverwrite
+		case "m", "merge":
+			strategy = strategyMerge
+		case "d", "diff":
+			if err := plan.Diff(update.Id, os.Stdout); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strategy {
+	case strategyOverwrite:
+		if err := plan.Overwrite(update.Id); err != nil {
+			return err
+		}
+		fmt.Printf("%s: updated\n", update.Id)
+	case strategyMerge:
+		conflicts, err := plan.Merge(update.Id)
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			fmt.Printf("%s: merged with conflicts in %s, resolve them before using the sandbox\n", update.Id, strings.Join(conflicts, ", "))
+		} else {
+			fmt.Printf("%s: merged\n", update.Id)
+		}
+	default:
+		fmt.Printf("%s: kept local version\n", update.Id)
+	}
+	return nil
+}
+
+// versionOrUnknown returns the version or a placeholder if it is not known
+func versionOrUnknown(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
+
+// isTerminal returns true if the file is a terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
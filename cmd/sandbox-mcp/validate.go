@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/testrunner"
+)
+
+// validateSandboxes checks the configurations and test cases of sandboxes
+// It returns a non-zero exit code if any sandbox is invalid
+func validateSandboxes(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	convert := flags.String("convert", "", fmt.Sprintf("Convert the config files of the valid sandboxes to another format: %s", strings.Join(config.Formats, ", ")))
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: sandbox-mcp validate [flags] [sandbox-id|directory...]")
+		fmt.Fprintln(flags.Output(), "\nCheck the configurations and test cases of the given sandboxes or all sandboxes.")
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *convert != "" && !slices.Contains(config.Formats, *convert) {
+		fmt.Fprintf(os.Stderr, "Unknown config format: %s\n", *convert)
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load sandbox-mcp configuration: %v\n", err)
+		return 1
+	}
+	if *convert != "" {
+		if err := cfg.CheckWritable(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	dirs, err := sandboxDirs(cfg.SandboxesPath, flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	invalid := 0
+	for _, dir := range dirs {
+		if !validateSandbox(dir) {
+			invalid++
+			continue
+		}
+		if *convert != "" {
+			path, err := config.ConvertSandboxConfig(dir, *convert)
+			if err != nil {
+				fmt.Printf("✗ %v\n", err)
+				invalid++
+				continue
+			}
+			fmt.Printf("  Converted the config to %s\n", path)
+		}
+	}
+
+	if invalid > 0 {
+		fmt.Printf("\n%d of %d sandboxes are invalid\n", invalid, len(dirs))
+		return 1
+	}
+	return 0
+}
+
+// sandboxDirs returns the directories of the sandboxes given by id or directory
+// Without arguments, it returns the directories of all sandboxes in all sandboxes directories
+func sandboxDirs(sandboxesPaths appconfig.Paths, args []string) ([]string, error) {
+	if len(args) == 0 {
+		var dirs []string
+		for _, sandboxesPath := range sandboxesPaths {
+			entries, err := os.ReadDir(sandboxesPath)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read sandbox directory: %v", err)
+			}
+			for _, entry := range entries {
+				if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+					dirs = append(dirs, filepath.Join(sandboxesPath, entry.Name()))
+				}
+			}
+		}
+		return dirs, nil
+	}
+
+	dirs := make([]string, 0, len(args))
+	for _, arg := range args {
+		// Sandboxes outside of the sandboxes directories are given by their directory
+		if info, err := os.Stat(arg); err == nil && info.IsDir() && strings.ContainsAny(arg, `/\.`) {
+			dirs = append(dirs, arg)
+			continue
+		}
+		dirs = append(dirs, findSandboxDir(sandboxesPaths, arg))
+	}
+	return dirs, nil
+}
+
+// findSandboxDir returns the directory of a sandbox in the last sandboxes directory that has it,
+// like the sandbox that is loaded, or in the first one if none has it
+func findSandboxDir(sandboxesPaths appconfig.Paths, id string) string {
+	for i := len(sandboxesPaths) - 1; i >= 0; i-- {
+		dir := filepath.Join(sandboxesPaths[i], id)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return filepath.Join(sandboxesPaths.Primary(), id)
+}
+
+// validateSandbox prints the problems and security warnings of the sandbox in a directory
+// It returns false if the sandbox is invalid
+func validateSandbox(dir string) bool {
+	sandboxCfg, err := config.LoadSandboxConfig(dir)
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", dir, err)
+		return false
+	}
+
+	var problems []string
+	if err := sandboxCfg.Validate(); err != nil {
+		problems = append(problems, strings.Split(err.Error(), "\n")...)
+	}
+	configs := map[string]*config.SandboxConfig{sandboxCfg.Id: sandboxCfg}
+	suites, err := testrunner.LoadSandboxSuites(configs, sandboxCfg.Id)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	name := sandboxCfg.Id
+	if name == "" {
+		name = dir
+	}
+	if len(problems) > 0 {
+		fmt.Printf("✗ %s has an invalid configuration:\n", name)
+		for _, problem := range problems {
+			fmt.Printf("    %s\n", problem)
+		}
+	} else {
+		fmt.Printf("✓ %s is valid (%d test cases)\n", name, countCases(suites))
+	}
+
+	warnings := sandboxCfg.SecurityWarnings()
+	sort.Strings(warnings)
+	for _, warning := range warnings {
+		fmt.Printf("  ! %s %s\n", name, warning)
+	}
+	return len(problems) == 0
+}
+
+// countCases returns the number of test cases in the suites
+func countCases(suites []*testrunner.Suite) int {
+	count := 0
+	for _, suite := range suites {
+		count += len(suite.Cases)
+	}
+	return count
+}
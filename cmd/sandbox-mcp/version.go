@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/pottekkat/sandbox-mcp/internal/version"
+)
+
+// printVersion prints the version and commit of the build
+func printVersion(args []string) int {
+	fmt.Printf("sandbox-mcp %s\n", version.GetVersion())
+	fmt.Printf("commit: %s\n", version.GetCommitSHA())
+	fmt.Printf("go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return 0
+}
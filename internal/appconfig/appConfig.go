@@ -3,9 +3,12 @@ package appconfig
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/adrg/xdg"
 )
@@ -15,93 +18,294 @@ const (
 	defaultConfigFileName = "config.json"
 )
 
+// Tool modes select which tools the server exposes
+const (
+	// ToolModeSandbox exposes one tool per sandbox
+	ToolModeSandbox = "sandbox"
+	// ToolModeMeta exposes the list_sandboxes, describe_sandbox and run_sandbox tools
+	ToolModeMeta = "meta"
+	// ToolModeAll exposes both the sandbox tools and the meta tools
+	ToolModeAll = "all"
+)
+
+// Image policies decide what happens when the image of a sandbox is missing
+const (
+	// ImagePolicyNever fails the tool call if the image is missing
+	ImagePolicyNever = "never"
+	// ImagePolicyBuildIfMissing builds the image from the sandbox directory
+	ImagePolicyBuildIfMissing = "build-if-missing"
+	// ImagePolicyPullIfMissing pulls the image from a registry
+	ImagePolicyPullIfMissing = "pull-if-missing"
+)
+
+// SourceRelease is the URL of the signed sandboxes of the GitHub release of the current version
+const SourceRelease = "release"
+
+// Source is a location to pull sandboxes from
+type Source struct {
+	// Name identifies the source in the logs
+	Name string `json:"name,omitempty"`
+	// URL is an HTTP(S) URL or a path of a tar.gz archive, a path of a directory
+	// like a git checkout, or release for the GitHub release
+	URL string `json:"url"`
+	// SHA256 is the expected checksum of an archive, which is not verified if empty
+	SHA256 string `json:"sha256,omitempty"`
+	// Sandboxes are the ids of the sandboxes to install from the source, all if empty
+	Sandboxes []string `json:"sandboxes,omitempty"`
+}
+
+// Describe returns the name of the source if set, otherwise its URL
+func (s *Source) Describe() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.URL
+}
+
 // Config holds the core configuration for sandbox-mcp
+// Each field can be overridden with the environment variable in its env tag
 type Config struct {
-	// SandboxesPath is the path to the sandboxes directory
-	SandboxesPath string `json:"sandboxesPath"`
+	// SandboxesPath are the sandboxes directories in order of precedence
+	// The first one is where sandboxes are pulled to
+	SandboxesPath Paths `json:"sandboxesPath" env:"SANDBOX_MCP_SANDBOXES"`
+	// MaxConcurrency is the maximum number of sandboxes running at the same time
+	// Zero means no limit
+	MaxConcurrency int `json:"maxConcurrency" env:"SANDBOX_MCP_MAX_CONCURRENCY"`
+	// ToolMode selects which tools the server exposes
+	// Defaults to one tool per sandbox
+	ToolMode string `json:"toolMode" env:"SANDBOX_MCP_TOOL_MODE"`
+	// ImagePolicy decides what happens when the image of a sandbox is missing
+	// Defaults to failing the tool call
+	ImagePolicy string `json:"imagePolicy" env:"SANDBOX_MCP_IMAGE_POLICY"`
+	// Sources are the locations to pull sandboxes from in order
+	// Defaults to the GitHub release of the current version
+	Sources []Source `json:"sources,omitempty" env:"SANDBOX_MCP_SOURCES"`
+	// EnabledSandboxes are the ids of the sandboxes to expose, all if empty
+	EnabledSandboxes []string `json:"enabledSandboxes,omitempty" env:"SANDBOX_MCP_ENABLED_SANDBOXES"`
+	// DisabledSandboxes are the ids of the sandboxes to hide
+	DisabledSandboxes []string `json:"disabledSandboxes,omitempty" env:"SANDBOX_MCP_DISABLED_SANDBOXES"`
+	// Limits cap the resources and timeouts of all sandboxes
+	Limits *Limits `json:"limits,omitempty" env:"SANDBOX_MCP_LIMITS"`
+	// ForceNoNetwork disables the network of all sandboxes
+	ForceNoNetwork bool `json:"forceNoNetwork,omitempty" env:"SANDBOX_MCP_FORCE_NO_NETWORK"`
+	// Overrides are deep-merged over the configuration of the sandbox with the same id
+	Overrides map[string]map[string]any `json:"overrides,omitempty" env:"SANDBOX_MCP_OVERRIDES"`
+	// ReadOnly never writes to disk, like the default config file or pulled sandboxes
+	ReadOnly bool `json:"readOnly,omitempty" env:"SANDBOX_MCP_READ_ONLY"`
+	// Strict fails on unknown sandboxes in the enabled sandboxes instead of ignoring them
+	Strict bool `json:"strict,omitempty" env:"SANDBOX_MCP_STRICT"`
+
+	// path is the config file the configuration was loaded from
+	path string
+	// origins are where the values come from by their key
+	origins map[string]string
+}
+
+// SandboxTools returns true if the server should expose one tool per sandbox
+func (c *Config) SandboxTools() bool {
+	return c.ToolMode != ToolModeMeta
+}
+
+// MetaTools returns true if the server should expose the meta tools
+func (c *Config) MetaTools() bool {
+	return c.ToolMode == ToolModeMeta || c.ToolMode == ToolModeAll
 }
 
 // DefaultConfig creates a default configuration
 func DefaultConfig() *Config {
 	// Default config path plus the sandboxes directory
 	defaultSandboxesPath := filepath.Join(xdg.ConfigHome, appName, "sandboxes")
-	log.Printf("Creating default configuration with sandboxes path: %s", defaultSandboxesPath)
 	return &Config{
-		SandboxesPath: defaultSandboxesPath,
+		SandboxesPath: Paths{defaultSandboxesPath},
+		ToolMode:      ToolModeSandbox,
+		ImagePolicy:   ImagePolicyNever,
 	}
 }
 
-// LoadConfig loads the configuration from the config.json file
+// LoadOptions configure where the configuration is loaded from
+type LoadOptions struct {
+	// Path is the config file, defaults to $SANDBOX_MCP_CONFIG or $XDG_CONFIG_HOME/sandbox-mcp/config.json
+	// Unlike the default config file, it is not created if it does not exist
+	Path string
+	// ReadOnly never writes the default config file or creates the sandboxes directory
+	ReadOnly bool
+	// Strict fails on unknown sandboxes in the enabled sandboxes
+	Strict bool
+}
+
+// LoadConfig loads the configuration from the default config.json file
 // If the config file doesn't exist, it creates one with default values
 func LoadConfig() (*Config, error) {
-	configPath := filepath.Join(xdg.ConfigHome, appName, defaultConfigFileName)
-	log.Printf("Looking for config file at: %s", configPath)
+	return Load(LoadOptions{})
+}
 
-	// Check if config directory exists, create if not
-	configDir := filepath.Dir(configPath)
-	if _, err := os.Stat(configDir); os.IsNotExist(err) {
-		log.Printf("Config directory does not exist, creating: %s", configDir)
-		if err := os.MkdirAll(configDir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create config directory: %w", err)
+// Load loads the configuration from the config file over the default values,
+// and then overrides it with the SANDBOX_MCP_* environment variables
+// If the default config file doesn't exist, it creates one with default values unless read-only
+func Load(opts LoadOptions) (*Config, error) {
+	configPath := opts.Path
+	if configPath == "" {
+		configPath = os.Getenv(configEnv)
+	}
+	explicit := configPath != ""
+	if !explicit {
+		configPath = filepath.Join(xdg.ConfigHome, appName, defaultConfigFileName)
+	}
+	slog.Debug("Looking for config file", "path", configPath)
+
+	// Read-only mode is needed before the config file is read to not create it
+	readOnly := opts.ReadOnly
+	if value, ok := os.LookupEnv(readOnlyEnv); ok {
+		if parsed, err := strconv.ParseBool(value); err == nil && parsed {
+			readOnly = true
 		}
-		log.Printf("Created config directory: %s", configDir)
-	} else {
-		log.Printf("Config directory already exists: %s", configDir)
 	}
 
+	config := DefaultConfig()
+	config.path = configPath
+	config.origins = make(map[string]string)
+
 	// Try to read existing config
-	config := &Config{}
-	if data, err := os.ReadFile(configPath); err == nil {
-		log.Printf("Found existing config file, attempting to parse")
-		if err := json.Unmarshal(data, config); err != nil {
+	data, err := os.ReadFile(configPath)
+	switch {
+	case err == nil:
+		slog.Debug("Found existing config file, attempting to parse")
+		if err := config.loadFile(data); err != nil {
 			return nil, fmt.Errorf("failed to parse config file: %w", err)
 		}
-		log.Printf("Successfully loaded existing config with sandboxes path: %s", config.SandboxesPath)
-		return config, nil
-	} else {
-		log.Printf("No existing config file found: %v", err)
+		slog.Debug("Loaded existing config", "sandboxesPath", config.SandboxesPath.String())
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	case explicit:
+		return nil, fmt.Errorf("config file %s does not exist", configPath)
+	case readOnly:
+		slog.Debug("No existing config file found, using default values in read-only mode")
+	default:
+		slog.Debug("No existing config file found", "error", err)
+		if err := config.createDefault(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Config doesn't exist, create default config
-	log.Println("Creating new configuration with default values")
-	config = DefaultConfig()
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if opts.ReadOnly && !config.ReadOnly {
+		config.ReadOnly = true
+		config.origins["readOnly"] = "flag --read-only"
+	}
+	if opts.Strict && !config.Strict {
+		config.Strict = true
+		config.origins["strict"] = "flag --strict"
+	}
+	return config, nil
+}
+
+// validate checks that the values with a fixed set of choices are known
+// Empty values use the defaults
+func (c *Config) validate() error {
+	choices := []struct {
+		key     string
+		value   string
+		allowed []string
+	}{
+		{"toolMode", c.ToolMode, []string{ToolModeSandbox, ToolModeMeta, ToolModeAll}},
+		{"imagePolicy", c.ImagePolicy, []string{ImagePolicyNever, ImagePolicyBuildIfMissing, ImagePolicyPullIfMissing}},
+	}
+	for _, choice := range choices {
+		if choice.value != "" && !slices.Contains(choice.allowed, choice.value) {
+			return fmt.Errorf("invalid %s %q from %s, must be one of %s",
+				choice.key, choice.value, c.origin(choice.key), strings.Join(choice.allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// origin returns where the value of a key comes from
+func (c *Config) origin(key string) string {
+	if origin, ok := c.origins[key]; ok {
+		return origin
+	}
+	return "default"
+}
+
+// loadFile reads the config file over the current values and records the keys it sets
+func (c *Config) loadFile(data []byte) error {
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	for key := range keys {
+		c.origins[key] = "file " + c.path
+	}
+	return nil
+}
+
+// createDefault creates the config directory, the sandboxes directory and the config file with default values
+func (c *Config) createDefault() error {
+	// Check if config directory exists, create if not
+	configDir := filepath.Dir(c.path)
+	if _, err := os.Stat(configDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+		slog.Debug("Created config directory", "path", configDir)
+	}
 
 	// Create sandboxes directory
-	if _, err := os.Stat(config.SandboxesPath); os.IsNotExist(err) {
-		log.Printf("Sandboxes directory does not exist, creating: %s", config.SandboxesPath)
-		if err := os.MkdirAll(config.SandboxesPath, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create sandboxes directory: %w", err)
+	sandboxesPath := c.SandboxesPath.Primary()
+	if _, err := os.Stat(sandboxesPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(sandboxesPath, 0755); err != nil {
+			return fmt.Errorf("failed to create sandboxes directory: %w", err)
 		}
-		log.Printf("Created sandboxes directory: %s", config.SandboxesPath)
-	} else {
-		log.Printf("Sandboxes directory already exists: %s", config.SandboxesPath)
+		slog.Debug("Created sandboxes directory", "path", sandboxesPath)
 	}
 
 	// Save default config
-	log.Printf("Saving default configuration to: %s", configPath)
-	if err := config.Save(); err != nil {
-		return nil, fmt.Errorf("failed to save default config: %w", err)
+	if err := c.Save(); err != nil {
+		return fmt.Errorf("failed to save default config: %w", err)
+	}
+	slog.Info("Created default config file", "path", c.path)
+	return nil
+}
+
+// CheckWritable returns an error in read-only mode, for commands that write to disk
+func (c *Config) CheckWritable() error {
+	if c.ReadOnly {
+		return fmt.Errorf("sandbox-mcp is in read-only mode (%s)", c.origins["readOnly"])
 	}
-	log.Println("Successfully saved default configuration")
+	return nil
+}
 
-	return config, nil
+// Path returns the config file the configuration was loaded from
+func (c *Config) Path() string {
+	return c.path
 }
 
 // Save saves the configuration to the config file
 func (c *Config) Save() error {
-	configPath := filepath.Join(xdg.ConfigHome, appName, defaultConfigFileName)
-	log.Printf("Preparing to save configuration to: %s", configPath)
-
+	if err := c.CheckWritable(); err != nil {
+		return err
+	}
+	configPath := c.path
+	if configPath == "" {
+		configPath = filepath.Join(xdg.ConfigHome, appName, defaultConfigFileName)
+	}
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
-	log.Printf("Configuration JSON prepared: %s", string(data))
 
 	if err := os.WriteFile(configPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
-	log.Printf("Successfully wrote configuration to: %s", configPath)
+	slog.Debug("Saved configuration", "path", configPath)
 
 	return nil
 }
@@ -0,0 +1,121 @@
+package appconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// configEnv is the path of the config file
+	configEnv = "SANDBOX_MCP_CONFIG"
+	// readOnlyEnv is the environment variable of the read-only mode
+	readOnlyEnv = "SANDBOX_MCP_READ_ONLY"
+)
+
+// Value is a value of the effective configuration
+type Value struct {
+	// Key is the key in the config file
+	Key string
+	// Env is the environment variable that overrides the value
+	Env   string
+	Value any
+	// Origin is where the value comes from, like default, the config file, an environment variable or a flag
+	Origin string
+}
+
+// applyEnv overrides the configuration with the environment variables in the env tags of the fields
+// Lists of strings can be separated by commas, and other lists and objects are JSON
+func (c *Config) applyEnv() error {
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := field.Tag.Get("env")
+		env, ok := os.LookupEnv(name)
+		if name == "" || !ok || env == "" {
+			continue
+		}
+
+		if err := setFromEnv(value.Field(i), env); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+		slog.Debug("Using configuration value from the environment", "key", jsonKey(field), "env", name)
+		c.origins[jsonKey(field)] = "env " + name
+	}
+	return nil
+}
+
+// setFromEnv parses the value of an environment variable into a field
+func setFromEnv(field reflect.Value, env string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(Paths{}):
+		field.Set(reflect.ValueOf(ParsePaths(env)))
+	case field.Kind() == reflect.String:
+		field.SetString(env)
+	case field.Kind() == reflect.Int:
+		parsed, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+	case field.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case field.Type() == reflect.TypeOf([]string{}) && !strings.HasPrefix(strings.TrimSpace(env), "["):
+		var items []string
+		for _, item := range strings.Split(env, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		// Unmarshal into a new value to not merge with the value of the config file
+		parsed := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(env), parsed.Interface()); err != nil {
+			return err
+		}
+		field.Set(parsed.Elem())
+	}
+	return nil
+}
+
+// SetOrigin records where a value that was changed after loading comes from, like a flag
+func (c *Config) SetOrigin(key string, origin string) {
+	if c.origins == nil {
+		c.origins = make(map[string]string)
+	}
+	c.origins[key] = origin
+}
+
+// Values returns the values of the configuration with where they come from in the order of the fields
+func (c *Config) Values() []Value {
+	value := reflect.ValueOf(c).Elem()
+	var values []Value
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		values = append(values, Value{
+			Key:    jsonKey(field),
+			Env:    field.Tag.Get("env"),
+			Value:  value.Field(i).Interface(),
+			Origin: c.origin(jsonKey(field)),
+		})
+	}
+	return values
+}
+
+// jsonKey returns the key of a field in the config file
+func jsonKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return key
+}
@@ -0,0 +1,100 @@
+package appconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+)
+
+func TestLoadOverridesWithEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"sandboxesPath": "/sandboxes", "maxConcurrency": 2, "enabledSandboxes": ["python"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SANDBOX_MCP_MAX_CONCURRENCY", "4")
+	t.Setenv("SANDBOX_MCP_DISABLED_SANDBOXES", "go, rust")
+	t.Setenv("SANDBOX_MCP_LIMITS", `{"memory": 256}`)
+
+	cfg, err := appconfig.Load(appconfig.LoadOptions{Path: path, ReadOnly: true, Strict: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxConcurrency != 4 || cfg.Limits == nil || cfg.Limits.Memory != 256 || !reflect.DeepEqual(cfg.DisabledSandboxes, []string{"go", "rust"}) {
+		t.Errorf("expected the environment variables to override the config file, got %+v", cfg)
+	}
+
+	origins := make(map[string]string)
+	for _, value := range cfg.Values() {
+		origins[value.Key] = value.Origin
+	}
+	expected := map[string]string{
+		"sandboxesPath":     "file " + path,
+		"enabledSandboxes":  "file " + path,
+		"maxConcurrency":    "env SANDBOX_MCP_MAX_CONCURRENCY",
+		"disabledSandboxes": "env SANDBOX_MCP_DISABLED_SANDBOXES",
+		"toolMode":          "default",
+		"readOnly":          "flag --read-only",
+		"strict":            "flag --strict",
+	}
+	for key, origin := range expected {
+		if origins[key] != origin {
+			t.Errorf("expected %s to come from %q, got %q", key, origin, origins[key])
+		}
+	}
+
+	if err := cfg.Save(); err == nil {
+		t.Error("expected saving to fail in read-only mode")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := appconfig.Load(appconfig.LoadOptions{Path: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SANDBOX_MCP_FORCE_NO_NETWORK", "maybe")
+	if _, err := appconfig.Load(appconfig.LoadOptions{Path: path}); err == nil {
+		t.Error("expected an error for an invalid environment variable")
+	}
+}
+
+func TestLoadRejectsUnknownChoices(t *testing.T) {
+	tests := map[string]struct {
+		file string
+		env  map[string]string
+		err  string
+	}{
+		"tool mode":          {file: `{"toolMode": "tools"}`, err: `invalid toolMode "tools" from file`},
+		"image policy":       {file: `{"imagePolicy": "always"}`, err: `invalid imagePolicy "always" from file`},
+		"image policy env":   {file: `{}`, env: map[string]string{"SANDBOX_MCP_IMAGE_POLICY": "build"}, err: "env SANDBOX_MCP_IMAGE_POLICY"},
+		"known tool mode":    {file: `{"toolMode": "all"}`},
+		"known image policy": {file: `{"imagePolicy": "pull-if-missing"}`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := appconfig.Load(appconfig.LoadOptions{Path: path, ReadOnly: true})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package appconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Paths are the directories to load sandboxes from in order of precedence,
+// sandboxes in later directories replace the sandboxes with the same id in earlier directories
+// In the config file, it is either a single path or a list of paths
+type Paths []string
+
+// ParsePaths splits a list of paths separated like in PATH, by ':' or ';' on Windows
+func ParsePaths(list string) Paths {
+	var paths Paths
+	for _, path := range filepath.SplitList(list) {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// UnmarshalJSON reads a single path or a list of paths
+func (p *Paths) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*p = Paths{path}
+		return nil
+	}
+
+	var paths []string
+	if err := json.Unmarshal(data, &paths); err != nil {
+		return fmt.Errorf("sandboxesPath must be a path or a list of paths")
+	}
+	*p = paths
+	return nil
+}
+
+// MarshalJSON writes a single path as a string, so that existing config files stay the same
+func (p Paths) MarshalJSON() ([]byte, error) {
+	if len(p) == 1 {
+		return json.Marshal(p[0])
+	}
+	return json.Marshal([]string(p))
+}
+
+// Primary returns the first path, where sandboxes are pulled, updated and created
+func (p Paths) Primary() string {
+	if len(p) == 0 {
+		return ""
+	}
+	return p[0]
+}
+
+// String returns the paths separated like in PATH
+func (p Paths) String() string {
+	return strings.Join(p, string(os.PathListSeparator))
+}
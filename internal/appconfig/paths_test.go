@@ -0,0 +1,51 @@
+package appconfig_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+)
+
+func TestSandboxesPathIsPathOrList(t *testing.T) {
+	tests := []struct {
+		json  string
+		paths appconfig.Paths
+	}{
+		{`{"sandboxesPath": "/sandboxes"}`, appconfig.Paths{"/sandboxes"}},
+		{`{"sandboxesPath": ["/sandboxes", "./.sandbox-mcp"]}`, appconfig.Paths{"/sandboxes", "./.sandbox-mcp"}},
+	}
+
+	for _, tt := range tests {
+		var cfg appconfig.Config
+		if err := json.Unmarshal([]byte(tt.json), &cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(cfg.SandboxesPath, tt.paths) {
+			t.Errorf("expected %v, got %v", tt.paths, cfg.SandboxesPath)
+		}
+
+		// A single path is saved as it was
+		data, err := json.Marshal(appconfig.Config{SandboxesPath: tt.paths})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved map[string]any
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatal(err)
+		}
+		var original map[string]any
+		if err := json.Unmarshal([]byte(tt.json), &original); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(saved["sandboxesPath"], original["sandboxesPath"]) {
+			t.Errorf("expected %v to be saved, got %v", original["sandboxesPath"], saved["sandboxesPath"])
+		}
+	}
+
+	var cfg appconfig.Config
+	if err := json.Unmarshal([]byte(`{"sandboxesPath": 1}`), &cfg); err == nil {
+		t.Error("expected an error for an invalid sandboxes path")
+	}
+}
@@ -0,0 +1,159 @@
+package appconfig
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// Limits are upper bounds for the resources and timeouts of all sandboxes
+// Zero means no limit
+type Limits struct {
+	CPU       int   `json:"cpu,omitempty"`
+	Memory    int64 `json:"memory,omitempty"`
+	Processes int64 `json:"processes,omitempty"`
+	Files     int64 `json:"files,omitempty"`
+	// Timeout is the maximum timeout in seconds, also of the setup and phases
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// ApplyPolicy applies the enabled and disabled sandboxes, the per-sandbox overrides,
+// the limits and the network switch of the configuration to the sandboxes
+// The overrides are applied first, so that they cannot exceed the limits
+// Overridden sandboxes are validated again, as an override can make them invalid
+func (c *Config) ApplyPolicy(configs map[string]*config.SandboxConfig) (map[string]*config.SandboxConfig, error) {
+	if unknown := c.UnknownEnabled(configs); c.Strict && len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown sandboxes in enabledSandboxes: %s", strings.Join(unknown, ", "))
+	}
+	for _, id := range c.policyIds() {
+		if _, ok := configs[id]; !ok {
+			slog.Warn("Ignoring the policy of unknown sandbox", "sandbox", id)
+		}
+	}
+
+	applied := make(map[string]*config.SandboxConfig, len(configs))
+	for id, sandboxCfg := range configs {
+		if !c.Enabled(id) {
+			continue
+		}
+
+		override, overridden := c.Overrides[id]
+		if overridden {
+			merged, err := config.Override(sandboxCfg, override)
+			if err != nil {
+				return nil, err
+			}
+			if err := merged.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid override of sandbox %s: %s", id, strings.ReplaceAll(err.Error(), "\n", ", "))
+			}
+			sandboxCfg = merged
+		} else {
+			// Copy the config so that the loaded config is not changed
+			copied := *sandboxCfg
+			sandboxCfg = &copied
+		}
+
+		if c.Limits != nil {
+			c.Limits.apply(sandboxCfg)
+		}
+		if c.ForceNoNetwork {
+			forceNoNetwork(sandboxCfg)
+		}
+		// Warn about overrides that weaken the isolation, after the network switch is applied
+		if overridden {
+			for _, warning := range sandboxCfg.SecurityWarnings() {
+				slog.Warn("Overridden sandbox weakens its isolation", "sandbox", id, "warning", warning)
+			}
+		}
+		applied[id] = sandboxCfg
+	}
+	return applied, nil
+}
+
+// Enabled returns true if a sandbox is in the enabled sandboxes, or there are none,
+// and it is not in the disabled sandboxes
+func (c *Config) Enabled(id string) bool {
+	if len(c.EnabledSandboxes) > 0 && !slices.Contains(c.EnabledSandboxes, id) {
+		return false
+	}
+	return !slices.Contains(c.DisabledSandboxes, id)
+}
+
+// UnknownEnabled returns the enabled sandboxes that are not in the loaded sandboxes
+func (c *Config) UnknownEnabled(configs map[string]*config.SandboxConfig) []string {
+	var unknown []string
+	for _, id := range c.EnabledSandboxes {
+		if _, ok := configs[id]; !ok {
+			unknown = append(unknown, id)
+		}
+	}
+	return unknown
+}
+
+// policyIds returns the sandbox ids the policy refers to
+func (c *Config) policyIds() []string {
+	ids := append(slices.Clone(c.EnabledSandboxes), c.DisabledSandboxes...)
+	for id := range c.Overrides {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return slices.Compact(ids)
+}
+
+// apply clamps the resources and timeouts of a sandbox to the limits
+func (l *Limits) apply(cfg *config.SandboxConfig) {
+	cfg.Resources.CPU = clamp(cfg.Resources.CPU, l.CPU)
+	cfg.Resources.Memory = clamp(cfg.Resources.Memory, l.Memory)
+	cfg.Resources.Processes = clamp(cfg.Resources.Processes, l.Processes)
+	cfg.Resources.Files = clamp(cfg.Resources.Files, l.Files)
+	cfg.TimeoutRaw = clamp(cfg.TimeoutRaw, l.Timeout)
+
+	if cfg.Setup != nil {
+		setup := *cfg.Setup
+		setup.TimeoutRaw = clampOptional(setup.TimeoutRaw, l.Timeout)
+		cfg.Setup = &setup
+	}
+	if cfg.Phases != nil {
+		cfg.Phases = slices.Clone(cfg.Phases)
+		for i := range cfg.Phases {
+			cfg.Phases[i].TimeoutRaw = clampOptional(cfg.Phases[i].TimeoutRaw, l.Timeout)
+		}
+	}
+}
+
+// clamp returns value capped at limit
+// An unset value means no limit, so it is set to the limit
+func clamp[T int | int64](value T, limit T) T {
+	if limit > 0 && (value <= 0 || value > limit) {
+		return limit
+	}
+	return value
+}
+
+// clampOptional caps a value at limit, but keeps it unset so that it defaults to another value
+func clampOptional[T int | int64](value T, limit T) T {
+	if limit > 0 && value > limit {
+		return limit
+	}
+	return value
+}
+
+// forceNoNetwork disables the network of a sandbox, including its setup and phases
+func forceNoNetwork(cfg *config.SandboxConfig) {
+	cfg.Security.Network = "none"
+	if cfg.Setup != nil {
+		setup := *cfg.Setup
+		setup.Network = ""
+		cfg.Setup = &setup
+	}
+	if cfg.Phases != nil {
+		cfg.Phases = slices.Clone(cfg.Phases)
+		for i := range cfg.Phases {
+			cfg.Phases[i].Network = ""
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package appconfig_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// sandboxConfigs returns valid sandboxes with network access, a setup step and phases
+func sandboxConfigs() map[string]*config.SandboxConfig {
+	configs := map[string]*config.SandboxConfig{
+		"python": {
+			Id:         "python",
+			TimeoutRaw: 60,
+			Setup:      &config.SandboxSetup{Command: []string{"pip", "install"}, TimeoutRaw: 300, Network: "bridge"},
+			Security:   config.SandboxSecurity{Network: "bridge", CapDrop: []string{"all"}},
+			Resources:  config.SandboxResources{CPU: 4, Memory: 128},
+		},
+		"go": {
+			Id:         "go",
+			TimeoutRaw: 30,
+			Phases:     []config.SandboxPhase{{Name: "build", Command: []string{"go", "build"}, TimeoutRaw: 120, Network: "bridge"}},
+			Security:   config.SandboxSecurity{Network: "none"},
+			Resources:  config.SandboxResources{CPU: 1, Memory: 1024},
+		},
+		"shell": {Id: "shell", TimeoutRaw: 10, Security: config.SandboxSecurity{Network: "none"}},
+	}
+	for _, cfg := range configs {
+		cfg.Image = "sandbox-mcp/" + cfg.Id + ":latest"
+		cfg.Entrypoint = "main"
+		cfg.Command = []string{"run", "main"}
+		cfg.Mount.WorkDir = "/sandbox"
+	}
+	return configs
+}
+
+func TestApplyPolicy(t *testing.T) {
+	loaded := sandboxConfigs()
+	cfg := &appconfig.Config{
+		DisabledSandboxes: []string{"shell"},
+		Limits:            &appconfig.Limits{CPU: 2, Memory: 512, Timeout: 45},
+		ForceNoNetwork:    true,
+		Overrides: map[string]map[string]any{
+			"python": {"resources": map[string]any{"memory": 256}, "timeout": 20},
+		},
+	}
+
+	configs, err := cfg.ApplyPolicy(loaded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := configs["shell"]; ok || len(configs) != 2 {
+		t.Errorf("expected only python and go, got %d sandboxes", len(configs))
+	}
+
+	python := configs["python"]
+	if python.Resources.CPU != 2 || python.Resources.Memory != 256 || python.Resources.Processes != 0 || python.TimeoutRaw != 20 {
+		t.Errorf("unexpected python resources or timeout: %+v, %d", python.Resources, python.TimeoutRaw)
+	}
+	if python.Security.Network != "none" || python.SetupNetwork() != "none" || python.Setup.TimeoutRaw != 45 {
+		t.Errorf("expected no network and a capped setup, got %q, %+v", python.Security.Network, python.Setup)
+	}
+	if len(python.Security.CapDrop) != 1 || python.Setup.Command[0] != "pip" {
+		t.Errorf("expected the rest of the config to be kept, got %+v", python)
+	}
+
+	goCfg := configs["go"]
+	if goCfg.Resources.Memory != 512 || goCfg.TimeoutRaw != 30 || goCfg.Phases[0].TimeoutRaw != 45 || goCfg.PhasesNeedNetwork() {
+		t.Errorf("unexpected go config: %+v", goCfg)
+	}
+
+	// The loaded configs are not changed
+	if loaded["python"].Security.Network != "bridge" || loaded["go"].Phases[0].Network != "bridge" || loaded["python"].Setup.TimeoutRaw != 300 {
+		t.Error("expected the loaded configs to be unchanged")
+	}
+}
+
+func TestEnabledSandboxes(t *testing.T) {
+	cfg := &appconfig.Config{EnabledSandboxes: []string{"python", "go"}, DisabledSandboxes: []string{"go"}}
+
+	configs, err := cfg.ApplyPolicy(sandboxConfigs())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := configs["python"]; !ok || len(configs) != 1 {
+		t.Errorf("expected only python, got %d sandboxes", len(configs))
+	}
+}
+
+func TestApplyPolicyValidatesOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		override map[string]any
+		err      string
+	}{
+		{"empty network", map[string]any{"security": map[string]any{"network": ""}}, "security.network is required"},
+		{"negative timeout", map[string]any{"timeout": -1}, "timeout must be greater than zero"},
+		{"negative setup timeout", map[string]any{"setup": map[string]any{"timeout": -5}}, "setup.timeout must not be negative"},
+		{"missing command", map[string]any{"command": nil}, "command or phases is required"},
+		{"phase on the host network", map[string]any{"phases": []any{map[string]any{"command": []any{"make"}, "network": "host"}}}, `phases[0].network cannot be "host"`},
+		{"phase on the network of a container", map[string]any{"phases": []any{map[string]any{"command": []any{"make"}, "network": "container:db"}}}, `phases[0].network cannot be "container:db"`},
+		{"phase network of a host sandbox", map[string]any{"security": map[string]any{"network": "host"}, "phases": []any{map[string]any{"command": []any{"make"}, "network": "none"}}}, `phases[0].network cannot be set when security.network is "host"`},
+		{"wrong type", map[string]any{"timeout": "long"}, "invalid override of sandbox python"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &appconfig.Config{Overrides: map[string]map[string]any{"python": tt.override}}
+			_, err := cfg.ApplyPolicy(sandboxConfigs())
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error with %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// Overrides that weaken the isolation are allowed, they are only logged
+	cfg := &appconfig.Config{Overrides: map[string]map[string]any{"python": {"security": map[string]any{"capDrop": []any{}}}}}
+	configs, err := cfg.ApplyPolicy(sandboxConfigs())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(configs["python"].Security.CapDrop) != 0 {
+		t.Errorf("expected no dropped capabilities, got %v", configs["python"].Security.CapDrop)
+	}
+}
+
+func TestUnknownEnabledSandboxes(t *testing.T) {
+	cfg := &appconfig.Config{EnabledSandboxes: []string{"python", "pyhton", "ruby"}, DisabledSandboxes: []string{"perl"}}
+
+	if unknown := cfg.UnknownEnabled(sandboxConfigs()); strings.Join(unknown, ",") != "pyhton,ruby" {
+		t.Errorf("expected pyhton and ruby to be unknown, got %v", unknown)
+	}
+
+	// Unknown sandboxes are ignored unless strict
+	configs, err := cfg.ApplyPolicy(sandboxConfigs())
+	if err != nil || len(configs) != 1 {
+		t.Fatalf("expected only python, got %d sandboxes and %v", len(configs), err)
+	}
+
+	cfg.Strict = true
+	if _, err := cfg.ApplyPolicy(sandboxConfigs()); err == nil || !strings.Contains(err.Error(), "unknown sandboxes in enabledSandboxes: pyhton, ruby") {
+		t.Errorf("expected an error about the unknown sandboxes, got %v", err)
+	}
+
+	// Unknown disabled sandboxes are harmless, also when strict
+	cfg.EnabledSandboxes = nil
+	if _, err := cfg.ApplyPolicy(sandboxConfigs()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -107,6 +109,39 @@ func (m *SandboxMount) ScriptPerms() os.FileMode {
 	return mode
 }
 
+// SandboxSetup represents a command that prepares the sandbox before the command is run
+// It runs in its own container, so only what it writes to the working directory is kept
+type SandboxSetup struct {
+	Command    []string `json:"command"`
+	TimeoutRaw int      `json:"timeout"`
+	Network    string   `json:"network,omitempty"`
+}
+
+// Timeout returns the setup timeout as a time.Duration
+func (s *SandboxSetup) Timeout() time.Duration {
+	return time.Duration(s.TimeoutRaw) * time.Second
+}
+
+// SandboxPhase represents a single step of a multi-phase sandbox
+type SandboxPhase struct {
+	Name            string   `json:"name"`
+	Command         []string `json:"command"`
+	TimeoutRaw      int      `json:"timeout"`
+	Network         string   `json:"network,omitempty"`
+	ContinueOnError bool     `json:"continueOnError"`
+}
+
+// Timeout returns the phase timeout as a time.Duration
+func (p *SandboxPhase) Timeout() time.Duration {
+	return time.Duration(p.TimeoutRaw) * time.Second
+}
+
+// SandboxVariant represents an image variant of a sandbox, like another language version
+type SandboxVariant struct {
+	Label string `json:"label"`
+	Image string `json:"image"`
+}
+
 // SandboxConfig represents the complete configuration for a sandbox environment
 type SandboxConfig struct {
 	// Basic configuration
@@ -116,15 +151,25 @@ type SandboxConfig struct {
 	Hints       SandboxHints      `json:"hints,omitempty"`
 	Version     string            `json:"version"`
 	Image       string            `json:"image"`
+	BuildArgs   map[string]string `json:"buildArgs,omitempty"`
+	Matrix      []SandboxVariant  `json:"matrix,omitempty"`
 	User        string            `json:"user"`
 	Entrypoint  string            `json:"entrypoint"`
 	TimeoutRaw  int               `json:"timeout"`
 	Before      []string          `json:"before"`
+	Setup       *SandboxSetup     `json:"setup,omitempty"`
 	Command     []string          `json:"command"`
+	Phases      []SandboxPhase    `json:"phases,omitempty"`
 	Parameters  SandboxParameters `json:"parameters"`
 	Security    SandboxSecurity   `json:"security"`
 	Resources   SandboxResources  `json:"resources"`
 	Mount       SandboxMount      `json:"mount"`
+	Inventory   []string          `json:"inventory,omitempty"`
+
+	// Dir is the directory the sandbox was loaded from
+	Dir string `json:"-"`
+	// ConfigFile is the path of the config file, like config.json or config.yaml
+	ConfigFile string `json:"-"`
 }
 
 // Name returns the name if set, otherwise falls back to Id
@@ -140,32 +185,221 @@ func (c *SandboxConfig) ParamEntrypoint() string {
 	return strings.ReplaceAll(c.Entrypoint, ".", "_")
 }
 
+// HasMatrix returns true if the sandbox runs on multiple image variants
+func (c *SandboxConfig) HasMatrix() bool {
+	return len(c.Matrix) > 0
+}
+
+// Variant returns the matrix variant with the given label
+func (c *SandboxConfig) Variant(label string) (*SandboxVariant, bool) {
+	for i := range c.Matrix {
+		if c.Matrix[i].Label == label {
+			return &c.Matrix[i], true
+		}
+	}
+	return nil, false
+}
+
+// Images returns the Docker images used by the sandbox, including the matrix variants
+func (c *SandboxConfig) Images() []string {
+	var images []string
+	seen := make(map[string]bool)
+	add := func(image string) {
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	add(c.Image)
+	for _, variant := range c.Matrix {
+		add(variant.Image)
+	}
+	return images
+}
+
 // Timeout returns the timeout as a time.Duration
 func (c *SandboxConfig) Timeout() time.Duration {
 	return time.Duration(c.TimeoutRaw) * time.Second
 }
 
+// keepAliveCommand keeps a sandbox running while its phases are executed
+var keepAliveCommand = []string{"sleep", "infinity"}
+
+// HasPhases returns true if the sandbox runs its phases instead of the command
+func (c *SandboxConfig) HasPhases() bool {
+	return len(c.Phases) > 0
+}
+
 // RunCommand returns the initial command to run in the sandbox
 func (c *SandboxConfig) RunCommand() []string {
 	if len(c.Before) > 0 {
 		return c.Before
 	}
+	// Keep the sandbox running so that the phases can be executed
+	if c.HasPhases() {
+		return keepAliveCommand
+	}
 	return c.Command
 }
 
 // ExecCommand returns the command to execute in a running sandbox
 func (c *SandboxConfig) ExecCommand() []string {
-	if len(c.Before) > 0 {
+	if len(c.Before) > 0 && !c.HasPhases() {
 		return c.Command
 	}
 	return nil
 }
 
+// PhaseNetwork returns the network mode of a phase
+// Defaults to the network configuration under security
+func (c *SandboxConfig) PhaseNetwork(phase *SandboxPhase) string {
+	if phase.Network != "" {
+		return phase.Network
+	}
+	return c.Security.Network
+}
+
+// PhasesNeedNetwork returns true if any phase uses another network than the sandbox
+func (c *SandboxConfig) PhasesNeedNetwork() bool {
+	for i := range c.Phases {
+		if c.PhaseNetwork(&c.Phases[i]) != c.Security.Network {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupNetwork returns the network mode of the setup command
+// Defaults to the network configuration under security
+func (c *SandboxConfig) SetupNetwork() string {
+	if c.Setup != nil && c.Setup.Network != "" {
+		return c.Setup.Network
+	}
+	return c.Security.Network
+}
+
+// SetupTimeout returns the timeout of the setup command
+// Defaults to the timeout of the sandbox
+func (c *SandboxConfig) SetupTimeout() time.Duration {
+	if c.Setup != nil && c.Setup.TimeoutRaw > 0 {
+		return c.Setup.Timeout()
+	}
+	return c.Timeout()
+}
+
 // Tty returns true if the sandbox should be run with a TTY
 func (c *SandboxConfig) Tty() bool {
 	return len(c.Before) > 0
 }
 
+// sharesNetwork returns true if a network mode shares the network of the host or another container
+func sharesNetwork(network string) bool {
+	return network == "host" || strings.HasPrefix(network, "container:")
+}
+
+// Validate checks the configuration for missing or invalid values
+// It returns all problems joined into a single error
+func (c *SandboxConfig) Validate() error {
+	var errs []error
+	if c.Id == "" {
+		errs = append(errs, fmt.Errorf("id is required"))
+	}
+	if c.Image == "" && !c.HasMatrix() {
+		errs = append(errs, fmt.Errorf("image is required"))
+	}
+	if c.Entrypoint == "" {
+		errs = append(errs, fmt.Errorf("entrypoint is required"))
+	}
+	if len(c.Command) == 0 && !c.HasPhases() {
+		errs = append(errs, fmt.Errorf("command or phases is required"))
+	}
+	if c.TimeoutRaw <= 0 {
+		errs = append(errs, fmt.Errorf("timeout must be greater than zero"))
+	}
+	if c.Security.Network == "" {
+		errs = append(errs, fmt.Errorf("security.network is required, use none to disable the network"))
+	}
+	if c.Mount.WorkDir == "" {
+		errs = append(errs, fmt.Errorf("mount.workdir is required"))
+	}
+	if c.Mount.ScriptPermsRaw != "" {
+		if _, err := parseFileMode(c.Mount.ScriptPermsRaw); err != nil {
+			errs = append(errs, fmt.Errorf("mount.scriptPerms: %v", err))
+		}
+	}
+	if c.Setup != nil && len(c.Setup.Command) == 0 {
+		errs = append(errs, fmt.Errorf("setup.command is required"))
+	}
+	if c.Setup != nil && c.Setup.TimeoutRaw < 0 {
+		errs = append(errs, fmt.Errorf("setup.timeout must not be negative"))
+	}
+	for i, phase := range c.Phases {
+		if len(phase.Command) == 0 {
+			errs = append(errs, fmt.Errorf("phases[%d].command is required", i))
+		}
+		if phase.TimeoutRaw < 0 {
+			errs = append(errs, fmt.Errorf("phases[%d].timeout must not be negative", i))
+		}
+		// Sandboxes cannot be connected to or disconnected from the network of the host or another container
+		if sharesNetwork(phase.Network) {
+			errs = append(errs, fmt.Errorf("phases[%d].network cannot be %q, the network of a phase must be none or a network to connect to", i, phase.Network))
+		} else if phase.Network != "" && phase.Network != c.Security.Network && sharesNetwork(c.Security.Network) {
+			errs = append(errs, fmt.Errorf("phases[%d].network cannot be set when security.network is %q", i, c.Security.Network))
+		}
+	}
+	labels := make(map[string]bool)
+	for i, variant := range c.Matrix {
+		if variant.Label == "" || variant.Image == "" {
+			errs = append(errs, fmt.Errorf("matrix[%d] requires a label and an image", i))
+		}
+		if labels[variant.Label] {
+			errs = append(errs, fmt.Errorf("matrix[%d].label %q is not unique", i, variant.Label))
+		}
+		labels[variant.Label] = true
+	}
+	for i, file := range c.Parameters.Files {
+		if file.Name == "" {
+			errs = append(errs, fmt.Errorf("parameters.files[%d].name is required", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SecurityWarnings returns the settings that weaken the isolation of the sandbox
+// They are not errors, as some sandboxes need them, like network tools
+func (c *SandboxConfig) SecurityWarnings() []string {
+	var warnings []string
+	if c.User == "" || c.User == "root" || c.User == "0" {
+		warnings = append(warnings, "runs as root, set user to a non-root user")
+	}
+	if !containsFold(c.Security.CapDrop, "all") {
+		warnings = append(warnings, "does not drop all capabilities, add \"all\" to security.capDrop")
+	}
+	noNewPrivileges := false
+	for _, opt := range c.Security.SecurityOpt {
+		if strings.HasPrefix(opt, "no-new-privileges") && !strings.HasSuffix(opt, "false") {
+			noNewPrivileges = true
+		}
+	}
+	if !noNewPrivileges {
+		warnings = append(warnings, "allows new privileges, add \"no-new-privileges:true\" to security.securityOpt")
+	}
+	if c.Security.Network != "none" {
+		warnings = append(warnings, fmt.Sprintf("has network access (security.network is %q)", c.Security.Network))
+	}
+	return warnings
+}
+
+// containsFold returns true if values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // parseFileMode converts a string like "0755" into os.FileMode
 func parseFileMode(mode string) (os.FileMode, error) {
 	// Parse as base-8 (octal)
@@ -186,23 +420,74 @@ func LoadSandboxConfigs(sandboxDir string) (map[string]*SandboxConfig, error) {
 	}
 
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		// Hidden directories, like the state of sandbox-mcp or .git, are not sandboxes
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
 
-		configPath := filepath.Join(sandboxDir, entry.Name(), "config.json")
-		configData, err := os.ReadFile(configPath)
+		config, err := LoadSandboxConfig(filepath.Join(sandboxDir, entry.Name()))
 		if err != nil {
-			return nil, fmt.Errorf("failed to read config file %s: %v", configPath, err)
+			return nil, err
 		}
+		configs[config.Id] = config
+	}
+
+	return configs, nil
+}
 
-		var config SandboxConfig
-		if err := json.Unmarshal(configData, &config); err != nil {
-			return nil, fmt.Errorf("failed to parse config file %s: %v", configPath, err)
+// LoadSandboxPaths loads the sandbox configurations from several sandboxes directories in order
+// Sandboxes in later directories replace the sandboxes with the same id in earlier directories
+// Directories that do not exist are skipped, like a project without sandboxes
+func LoadSandboxPaths(sandboxDirs []string) (map[string]*SandboxConfig, error) {
+	configs := make(map[string]*SandboxConfig)
+	for _, sandboxDir := range sandboxDirs {
+		if _, err := os.Stat(sandboxDir); os.IsNotExist(err) {
+			slog.Debug("Skipping missing sandboxes directory", "path", sandboxDir)
+			continue
 		}
 
-		configs[config.Id] = &config
+		dirConfigs, err := LoadSandboxConfigs(sandboxDir)
+		if err != nil {
+			return nil, err
+		}
+		for id, config := range dirConfigs {
+			if previous, ok := configs[id]; ok {
+				slog.Info("Sandbox replaces one from a lower precedence directory", "sandbox", id, "path", config.Dir, "replaced", previous.Dir)
+			}
+			configs[id] = config
+		}
 	}
-
 	return configs, nil
 }
+
+// LoadSandboxConfig loads the configuration of the sandbox in a directory
+// from a config.json, config.yaml or config.toml file
+// The configuration is merged over the base config it extends and the defaults file
+// in the parent directory
+func LoadSandboxConfig(dir string) (*SandboxConfig, error) {
+	configPath, err := findConfigFile(dir, configFileName)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	values, err := resolveConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the merged values through JSON to reuse the struct tags
+	configData, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config file %s: %v", configPath, err)
+	}
+	var config SandboxConfig
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", configPath, err)
+	}
+
+	config.Dir = dir
+	config.ConfigFile = configPath
+	return &config, nil
+}
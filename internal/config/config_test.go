@@ -0,0 +1,34 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+func TestLoadSandboxPathsPrecedence(t *testing.T) {
+	upstream := t.TempDir()
+	project := t.TempDir()
+	writeFiles(t, upstream, map[string]string{
+		"shell/config.json":  `{"id": "shell", "image": "upstream"}`,
+		"python/config.json": `{"id": "python", "image": "upstream"}`,
+	})
+	writeFiles(t, project, map[string]string{
+		"shell/config.json": `{"id": "shell", "image": "project"}`,
+	})
+
+	configs, err := config.LoadSandboxPaths([]string{upstream, filepath.Join(project, "missing"), project})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 sandboxes, got %d", len(configs))
+	}
+	if shell := configs["shell"]; shell.Image != "project" || shell.Dir != filepath.Join(project, "shell") {
+		t.Errorf("expected the project shell sandbox, got %q from %s", shell.Image, shell.Dir)
+	}
+	if python := configs["python"]; python.Image != "upstream" {
+		t.Errorf("expected the upstream python sandbox, got %q", python.Image)
+	}
+}
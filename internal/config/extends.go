@@ -0,0 +1,157 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// configFileName is the name of the config file of a sandbox without its extension
+	configFileName = "config"
+	// defaultsFileName is the name of the file in the sandboxes directory with defaults for all sandboxes
+	// without its extension
+	defaultsFileName = "defaults"
+	// extendsKey is the key of a config that points to the base config it extends
+	extendsKey = "extends"
+	// maxExtendsDepth limits how many base configs can be chained
+	maxExtendsDepth = 10
+)
+
+// DefaultsFiles returns the names of the defaults files of a sandboxes directory in every format
+func DefaultsFiles() []string {
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = defaultsFileName + "." + format
+	}
+	return names
+}
+
+// resolveConfig reads a config file and merges it over the base configs it extends
+// and the defaults.json of the sandboxes directory, in this order of precedence
+func resolveConfig(configPath string) (map[string]any, error) {
+	merged, err := resolveExtends(configPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sandboxes directory is the parent of the sandbox directory
+	defaultsPath, err := findConfigFile(filepath.Dir(filepath.Dir(configPath)), defaultsFileName)
+	if os.IsNotExist(err) {
+		return merged, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := readConfigMap(defaultsPath)
+	if err != nil {
+		return nil, err
+	}
+	delete(defaults, extendsKey)
+	return mergeMaps(defaults, merged), nil
+}
+
+// resolveExtends reads a config file and merges it over the chain of base configs it extends
+// The path in extends is relative to the directory of the config file
+func resolveExtends(configPath string, seen []string) (map[string]any, error) {
+	for _, path := range seen {
+		if path == configPath {
+			return nil, fmt.Errorf("config file %s extends itself", configPath)
+		}
+	}
+	if len(seen) >= maxExtendsDepth {
+		return nil, fmt.Errorf("config file %s extends more than %d configs", seen[0], maxExtendsDepth)
+	}
+
+	values, err := readConfigMap(configPath)
+	if os.IsNotExist(err) && len(seen) > 0 {
+		return nil, fmt.Errorf("config file %s extends %s, which does not exist", seen[len(seen)-1], configPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	extends, ok := values[extendsKey]
+	if !ok {
+		return values, nil
+	}
+	delete(values, extendsKey)
+
+	basePath, ok := extends.(string)
+	if !ok || basePath == "" {
+		return nil, fmt.Errorf("config file %s: extends must be the path of a config file", configPath)
+	}
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(configPath), basePath)
+	}
+
+	base, err := resolveExtends(filepath.Clean(basePath), append(seen, configPath))
+	if err != nil {
+		return nil, err
+	}
+	return mergeMaps(base, values), nil
+}
+
+// readConfigMap reads a JSON, YAML or TOML config file into a map
+func readConfigMap(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	values, err := decodeConfig(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// mergeMaps deep-merges overlay into base and returns the result
+// Objects are merged key by key, while arrays and other values in overlay replace the values in base
+func mergeMaps(base, overlay map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(overlay))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		baseMap, baseIsMap := merged[key].(map[string]any)
+		overlayMap, overlayIsMap := value.(map[string]any)
+		if baseIsMap && overlayIsMap {
+			merged[key] = mergeMaps(baseMap, overlayMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// Override deep-merges values over a sandbox configuration like a config file over the config it extends
+// The id, directory and config file of the sandbox are kept
+func Override(cfg *SandboxConfig, values map[string]any) (*SandboxConfig, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var base map[string]any
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(mergeMaps(base, values))
+	if err != nil {
+		return nil, err
+	}
+	var overridden SandboxConfig
+	if err := json.Unmarshal(data, &overridden); err != nil {
+		return nil, fmt.Errorf("invalid override of sandbox %s: %v", cfg.Id, err)
+	}
+
+	overridden.Id = cfg.Id
+	overridden.Dir = cfg.Dir
+	overridden.ConfigFile = cfg.ConfigFile
+	return &overridden, nil
+}
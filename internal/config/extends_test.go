@@ -0,0 +1,100 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// writeFiles writes files relative to a directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadSandboxConfigsMergesDefaultsAndExtends(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"defaults.json": `{
+			"timeout": 30,
+			"security": {"capDrop": ["all"], "securityOpt": ["no-new-privileges:true"], "network": "none"},
+			"mount": {"workdir": "/sandbox", "scriptPerms": "0755"}
+		}`,
+		"base/config.json": `{
+			"id": "base",
+			"image": "base:latest",
+			"security": {"readOnly": true, "capDrop": ["net_raw"]},
+			"resources": {"memory": 64}
+		}`,
+		"child/config.json": `{
+			"extends": "../base/config.json",
+			"id": "child",
+			"security": {"network": "bridge"},
+			"resources": {"cpu": 2}
+		}`,
+	})
+
+	configs, err := config.LoadSandboxConfigs(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 sandboxes, got %d", len(configs))
+	}
+
+	child := configs["child"]
+	if child.Image != "base:latest" || child.TimeoutRaw != 30 || child.Mount.WorkDir != "/sandbox" {
+		t.Errorf("expected inherited image, timeout and workdir, got %q, %d, %q", child.Image, child.TimeoutRaw, child.Mount.WorkDir)
+	}
+	// Objects are merged, arrays are replaced
+	if !reflect.DeepEqual(child.Security.CapDrop, []string{"net_raw"}) || !child.Security.ReadOnly || child.Security.Network != "bridge" {
+		t.Errorf("unexpected security: %+v", child.Security)
+	}
+	if child.Resources.CPU != 2 || child.Resources.Memory != 64 {
+		t.Errorf("unexpected resources: %+v", child.Resources)
+	}
+	if base := configs["base"]; base.Security.Network != "none" || len(base.Security.SecurityOpt) != 1 {
+		t.Errorf("expected defaults in base, got %+v", base.Security)
+	}
+}
+
+func TestLoadSandboxConfigsRejectsBadExtends(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"cycle", map[string]string{
+			"a/config.json": `{"id": "a", "extends": "../b/config.json"}`,
+			"b/config.json": `{"id": "b", "extends": "../a/config.json"}`,
+		}, "extends itself"},
+		{"missing", map[string]string{
+			"a/config.json": `{"id": "a", "extends": "../base.json"}`,
+		}, "does not exist"},
+		{"not a path", map[string]string{
+			"a/config.json": `{"id": "a", "extends": 1}`,
+		}, "must be the path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			if _, err := config.LoadSandboxConfigs(dir); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats are the supported config file formats by their file extension
+var Formats = []string{"json", "yaml", "toml"}
+
+// findConfigFile returns the path of the config file with the given name and any supported extension
+// The JSON file is preferred, as other files like the config.yaml of an application can sit next to it
+// It returns an error that satisfies os.IsNotExist if there is none, and an error if there are several without a JSON file
+func findConfigFile(dir string, name string) (string, error) {
+	var found []string
+	for _, format := range Formats {
+		path := filepath.Join(dir, name+"."+format)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", &os.PathError{Op: "open", Path: filepath.Join(dir, name+".json"), Err: os.ErrNotExist}
+	case 1:
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, path := range found {
+		names[i] = filepath.Base(path)
+	}
+	if filepath.Ext(found[0]) == ".json" {
+		slog.Warn("Using the JSON config file and ignoring the other config files", "dir", dir, "ignored", strings.Join(names[1:], ", "))
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%s has more than one config file (%s), keep only one", dir, strings.Join(names, ", "))
+}
+
+// configFormat returns the format of a config file from its extension
+func configFormat(path string) string {
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+// decodeConfig decodes a JSON, YAML or TOML config file into a map
+func decodeConfig(path string, data []byte) (map[string]any, error) {
+	var values map[string]any
+	var err error
+	switch format := configFormat(path); format {
+	case "json":
+		err = json.Unmarshal(data, &values)
+	case "yaml":
+		err = yaml.Unmarshal(data, &values)
+	case "toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = make(map[string]any)
+	}
+	return values, nil
+}
+
+// ConvertSandboxConfig converts the config file of the sandbox in a directory to another format
+// The config file is converted as it is, without the values it inherits, and the old file is removed
+// It returns the path of the new config file
+func ConvertSandboxConfig(dir string, format string) (string, error) {
+	configPath, err := findConfigFile(dir, configFileName)
+	if err != nil {
+		return "", err
+	}
+	if configFormat(configPath) == format {
+		return configPath, nil
+	}
+
+	values, err := readConfigMap(configPath)
+	if err != nil {
+		return "", err
+	}
+	data, err := encodeConfig(orderValues(values, reflect.TypeOf(SandboxConfig{})), format)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert %s: %v", configPath, err)
+	}
+
+	newPath := filepath.Join(dir, configFileName+"."+format)
+	if err := os.WriteFile(newPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", newPath, err)
+	}
+	if err := os.Remove(configPath); err != nil {
+		return "", fmt.Errorf("failed to remove %s: %v", configPath, err)
+	}
+	return newPath, nil
+}
+
+// orderedMap is a map that keeps the order of its keys when it is encoded
+type orderedMap []orderedEntry
+
+// orderedEntry is a key and value of an orderedMap
+type orderedEntry struct {
+	Key   string
+	Value any
+}
+
+// orderValues orders the keys of the maps in a value like the fields of the struct type it is decoded into,
+// so that converted config files read like the documentation
+// Keys that are not fields, like extends, come first in alphabetical order
+func orderValues(value any, t reflect.Type) any {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		fields := make(map[string]int)
+		fieldTypes := make(map[string]reflect.Type)
+		if t != nil && t.Kind() == reflect.Struct {
+			for i := 0; i < t.NumField(); i++ {
+				name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+				fields[name] = i
+				fieldTypes[name] = t.Field(i).Type
+			}
+		}
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			fi, iKnown := fields[keys[i]]
+			fj, jKnown := fields[keys[j]]
+			if iKnown != jKnown {
+				return !iKnown
+			}
+			if iKnown {
+				return fi < fj
+			}
+			return keys[i] < keys[j]
+		})
+
+		ordered := make(orderedMap, 0, len(keys))
+		for _, key := range keys {
+			ordered = append(ordered, orderedEntry{key, orderValues(value[key], fieldTypes[key])})
+		}
+		return ordered
+	case []any:
+		items := make([]any, len(value))
+		for i, item := range value {
+			items[i] = orderValues(item, t)
+		}
+		return items
+	case []map[string]any:
+		// TOML decodes arrays of tables like this
+		items := make([]any, len(value))
+		for i, item := range value {
+			items[i] = orderValues(item, t)
+		}
+		return items
+	}
+	return value
+}
+
+// encodeConfig encodes ordered config values in a format
+func encodeConfig(values any, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		var buf bytes.Buffer
+		if err := writeJSON(&buf, values); err != nil {
+			return nil, err
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, buf.Bytes(), "", "\t"); err != nil {
+			return nil, err
+		}
+		indented.WriteByte('\n')
+		return indented.Bytes(), nil
+	case "yaml":
+		node, err := yamlNode(values)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(node); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), encoder.Close()
+	case "toml":
+		if _, ok := values.(orderedMap); !ok {
+			return nil, fmt.Errorf("a TOML config must be a table")
+		}
+		table, err := tomlValue(values)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		encoder := toml.NewEncoder(&buf)
+		encoder.Indent = ""
+		if err := encoder.Encode(table); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported config format %q", format)
+}
+
+// writeJSON writes ordered values as compact JSON
+func writeJSON(buf *bytes.Buffer, value any) error {
+	switch value := value.(type) {
+	case orderedMap:
+		buf.WriteByte('{')
+		for i, entry := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, entry.Key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, entry.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		data, err := marshalJSON(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+// marshalJSON marshals a value without escaping characters like & in shell commands
+func marshalJSON(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// yamlNode converts ordered values into a YAML node
+// Multi-line strings, like shell scripts, are written as literal blocks
+func yamlNode(value any) (*yaml.Node, error) {
+	switch value := value.(type) {
+	case orderedMap:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, entry := range value {
+			child, err := yamlNode(entry.Value)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: entry.Key}, child)
+		}
+		return node, nil
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range value {
+			child, err := yamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	if s, ok := value.(string); ok && strings.Contains(s, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node, nil
+}
+
+// tomlValue converts ordered values into values that the TOML encoder writes in order
+// Tables become structs with a field for each key, as the encoder sorts the keys of maps
+// TOML has no null, so null values of tables are left out
+func tomlValue(value any) (any, error) {
+	switch value := value.(type) {
+	case orderedMap:
+		var fields []reflect.StructField
+		var values []reflect.Value
+		for _, entry := range value {
+			if entry.Value == nil {
+				continue
+			}
+			// The key is the name in the struct tag, where a comma starts the options
+			if strings.Contains(entry.Key, ",") {
+				return nil, fmt.Errorf("key %q cannot be written in TOML", entry.Key)
+			}
+			converted, err := tomlValue(entry.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", entry.Key, err)
+			}
+			fields = append(fields, reflect.StructField{
+				Name: fmt.Sprintf("Field%d", len(fields)),
+				Type: reflect.TypeOf(converted),
+				Tag:  reflect.StructTag(fmt.Sprintf("toml:%q", entry.Key)),
+			})
+			values = append(values, reflect.ValueOf(converted))
+		}
+
+		table := reflect.New(reflect.StructOf(fields)).Elem()
+		for i, v := range values {
+			table.Field(i).Set(v)
+		}
+		return table.Interface(), nil
+	case []any:
+		items := make([]any, len(value))
+		for i, item := range value {
+			if item == nil {
+				return nil, fmt.Errorf("arrays cannot have null values in TOML")
+			}
+			converted, err := tomlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = converted
+		}
+		return items, nil
+	case string:
+		if strings.Contains(value, "\n") {
+			return tomlMultiline(value), nil
+		}
+	case float64:
+		// JSON and YAML numbers without a fraction are TOML integers
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value), nil
+		}
+	}
+	return value, nil
+}
+
+// tomlMultiline is a multi-line string, like a shell script,
+// which is written as a literal string to keep it readable
+type tomlMultiline string
+
+// MarshalTOML writes the string as a multi-line literal string if it can be one
+func (s tomlMultiline) MarshalTOML() ([]byte, error) {
+	literal := !strings.Contains(string(s), "'''") && !strings.ContainsFunc(string(s), func(r rune) bool {
+		return r != '\n' && r != '\t' && unicode.IsControl(r)
+	})
+	if literal {
+		return []byte("'''\n" + string(s) + "'''"), nil
+	}
+	// JSON escapes are valid in TOML basic strings
+	return marshalJSON(string(s))
+}
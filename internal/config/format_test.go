@@ -0,0 +1,204 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+func TestLoadSandboxConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"id": "shell", "timeout": 60, "command": ["sh", "-c", "a && b"], "security": {"capDrop": ["all"]}}`,
+		"config.yaml": "id: shell\ntimeout: 60\ncommand:\n  - sh\n  - -c\n  - a && b\nsecurity:\n  capDrop: [all]\n",
+		"config.toml": "id = \"shell\"\ntimeout = 60\ncommand = [\"sh\", \"-c\", \"a && b\"]\n\n[security]\ncapDrop = [\"all\"]\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "shell")
+			writeFiles(t, dir, map[string]string{name: content})
+
+			cfg, err := config.LoadSandboxConfig(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Id != "shell" || cfg.TimeoutRaw != 60 || !reflect.DeepEqual(cfg.Command, []string{"sh", "-c", "a && b"}) || !reflect.DeepEqual(cfg.Security.CapDrop, []string{"all"}) {
+				t.Errorf("unexpected config: %+v", cfg)
+			}
+			if cfg.ConfigFile != filepath.Join(dir, name) {
+				t.Errorf("expected config file %s, got %s", name, cfg.ConfigFile)
+			}
+		})
+	}
+}
+
+func TestLoadSandboxConfigWithSeveralFiles(t *testing.T) {
+	// The JSON file is used if there is one, like the config.json of apisix next to its config.yaml
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.json": `{"id": "a"}`, "config.yaml": "deployment:\n  role: data_plane\n"})
+
+	cfg, err := config.LoadSandboxConfig(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Id != "a" || filepath.Base(cfg.ConfigFile) != "config.json" {
+		t.Errorf("expected the JSON config, got %s from %s", cfg.Id, cfg.ConfigFile)
+	}
+
+	// Without a JSON file it is not clear which file is the config
+	dir = t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.yaml": "id: a\n", "config.toml": "id = \"a\"\n"})
+	if _, err := config.LoadSandboxConfig(dir); err == nil || !strings.Contains(err.Error(), "more than one config file") {
+		t.Errorf("expected an error about several config files, got %v", err)
+	}
+}
+
+func TestConvertSandboxConfig(t *testing.T) {
+	original, err := config.LoadSandboxConfig("../../sandboxes/apisix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(original.ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "apisix")
+	writeFiles(t, dir, map[string]string{"config.json": string(data)})
+
+	// Every conversion keeps the values, and converting back keeps the file
+	for _, format := range []string{"yaml", "toml", "json"} {
+		path, err := config.ConvertSandboxConfig(dir, format)
+		if err != nil {
+			t.Fatalf("unexpected error converting to %s: %v", format, err)
+		}
+		if filepath.Base(path) != "config."+format {
+			t.Errorf("unexpected path %s", path)
+		}
+
+		converted, err := config.LoadSandboxConfig(dir)
+		if err != nil {
+			t.Fatalf("unexpected error loading %s: %v", format, err)
+		}
+		converted.Dir, converted.ConfigFile = original.Dir, original.ConfigFile
+		if !reflect.DeepEqual(original, converted) {
+			t.Errorf("%s config differs:\nexpected %+v\ngot      %+v", format, original, converted)
+		}
+	}
+
+	roundTrip, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(roundTrip) != string(data) {
+		t.Errorf("expected the same JSON after converting back, got:\n%s", roundTrip)
+	}
+}
+
+func TestConvertSandboxConfigToTOMLRoundTrip(t *testing.T) {
+	tests := map[string]string{
+		"multi-line command with quotes": `{
+	"id": "shell",
+	"command": [
+		"sh",
+		"-c",
+		"echo 'hello'\nprintf '%s\\n' \"$1\""
+	]
+}
+`,
+		"multi-line string with triple quotes": `{
+	"id": "shell",
+	"command": [
+		"sh",
+		"-c",
+		"cat <<'''\nEOF\n'''"
+	]
+}
+`,
+		"nested tables": `{
+	"id": "shell",
+	"security": {
+		"capDrop": [
+			"all"
+		],
+		"network": "none"
+	},
+	"mount": {
+		"workdir": "/sandbox"
+	}
+}
+`,
+		"arrays of tables": `{
+	"id": "shell",
+	"phases": [
+		{
+			"name": "build",
+			"command": [
+				"sh",
+				"-c",
+				"make\nmake install"
+			]
+		},
+		{
+			"name": "run",
+			"command": [
+				"./main"
+			]
+		}
+	],
+	"parameters": {
+		"files": [
+			{
+				"name": "input.txt",
+				"description": "Input"
+			},
+			{
+				"name": "data.csv",
+				"description": "It's \"data\""
+			}
+		]
+	}
+}
+`,
+	}
+	// Part of the TOML config of each test, multi-line strings are literal strings when possible
+	expected := map[string]string{
+		"multi-line command with quotes":       "'''\necho 'hello'\nprintf '%s\\n' \"$1\"'''",
+		"multi-line string with triple quotes": `"cat <<'''\nEOF\n'''"`,
+		"nested tables":                        "\n[security]\ncapDrop = [\"all\"]\nnetwork = \"none\"\n",
+		"arrays of tables":                     "\n[[parameters.files]]\nname = \"data.csv\"\ndescription = \"It's \\\"data\\\"\"\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "shell")
+			writeFiles(t, dir, map[string]string{"config.json": content})
+
+			path, err := config.ConvertSandboxConfig(dir, "toml")
+			if err != nil {
+				t.Fatalf("unexpected error converting to TOML: %v", err)
+			}
+			converted, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(converted), expected[name]) {
+				t.Errorf("expected %q in the TOML config, got:\n%s", expected[name], converted)
+			}
+			if _, err := config.ConvertSandboxConfig(dir, "json"); err != nil {
+				t.Fatalf("unexpected error converting back to JSON: %v\n%s", err, converted)
+			}
+
+			roundTrip, err := os.ReadFile(filepath.Join(dir, "config.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(roundTrip) != content {
+				t.Errorf("expected the same JSON after converting back, got:\n%s\nfrom TOML:\n%s", roundTrip, converted)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Formats of the log records
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configure the default logger
+type Options struct {
+	// Level is the minimum level of the logs: debug, info, warn or error
+	// Defaults to info
+	Level string
+	// Format is text or json, defaults to text
+	Format string
+	// File is the file the logs are appended to, defaults to stderr
+	// Stdout is never used as it is the stdio transport of the MCP server
+	File string
+}
+
+// Setup sets the default logger from the options
+// The logs are also sent to the MCP clients that set a log level
+// The log file stays open until the process exits
+func Setup(opts Options) error {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	if opts.Format != "" && opts.Format != FormatText && opts.Format != FormatJSON {
+		return fmt.Errorf("unknown log format: %s", opts.Format)
+	}
+
+	var output io.Writer = os.Stderr
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %v", err)
+		}
+		output = file
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(output, handlerOpts)
+	if opts.Format == FormatJSON {
+		handler = slog.NewJSONHandler(output, handlerOpts)
+	}
+
+	slog.SetDefault(slog.New(NewHandler(handler)))
+	return nil
+}
+
+// ParseLevel parses a log level like debug, info, warn, warning or error
+// An empty level is info
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	switch strings.ToLower(level) {
+	case "":
+		return slog.LevelInfo, nil
+	case "warning":
+		return slog.LevelWarn, nil
+	}
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return parsed, fmt.Errorf("unknown log level: %s", level)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,91 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pottekkat/sandbox-mcp/internal/logging"
+)
+
+// session is a client session that records its notifications
+type session struct {
+	id            string
+	level         mcp.LoggingLevel
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *session) SessionID() string                                   { return s.id }
+func (s *session) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+func (s *session) Initialize()                                         {}
+func (s *session) Initialized() bool                                   { return true }
+func (s *session) SetLogLevel(level mcp.LoggingLevel)                  { s.level = level }
+func (s *session) GetLogLevel() mcp.LoggingLevel                       { return s.level }
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"":        slog.LevelInfo,
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+	}
+	for input, expected := range tests {
+		level, err := logging.ParseLevel(input)
+		if err != nil || level != expected {
+			t.Errorf("ParseLevel(%q) = %v, %v, expected %v", input, level, err, expected)
+		}
+	}
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestMCPLevels(t *testing.T) {
+	levels := []mcp.LoggingLevel{
+		mcp.LoggingLevelDebug, mcp.LoggingLevelInfo, mcp.LoggingLevelNotice, mcp.LoggingLevelWarning,
+		mcp.LoggingLevelError, mcp.LoggingLevelCritical, mcp.LoggingLevelAlert, mcp.LoggingLevelEmergency,
+	}
+	for _, level := range levels {
+		if got := logging.ToMCPLevel(logging.FromMCPLevel(level)); got != level {
+			t.Errorf("expected %s to round trip, got %s", level, got)
+		}
+	}
+}
+
+func TestHandlerSendsToClients(t *testing.T) {
+	client := &session{id: "test", level: mcp.LoggingLevelWarning, notifications: make(chan mcp.JSONRPCNotification, 10)}
+	hooks := logging.Hooks()
+	hooks.RegisterSession(context.Background(), client)
+	defer hooks.UnregisterSession(context.Background(), client)
+
+	var output bytes.Buffer
+	logger := slog.New(logging.NewHandler(slog.NewTextHandler(&output, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	logger.Info("not sent")
+	logger.With("sandbox", "python").Warn("sent", "error", errors.New("failed"))
+
+	if len(client.notifications) != 1 {
+		t.Fatalf("expected one notification, got %d", len(client.notifications))
+	}
+	notification := <-client.notifications
+	params := notification.Params.AdditionalFields
+	data, _ := params["data"].(map[string]any)
+	if notification.Method != "notifications/message" || params["level"] != mcp.LoggingLevelWarning ||
+		data["message"] != "sent" || data["sandbox"] != "python" || data["error"] != "failed" {
+		t.Errorf("unexpected notification: %+v", notification)
+	}
+
+	// The output has its own level
+	if strings.Contains(output.String(), "sent") {
+		t.Errorf("expected no output below the error level, got %q", output.String())
+	}
+}
+
+var _ server.SessionWithLogging = (*session)(nil)
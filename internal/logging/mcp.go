@@ -0,0 +1,216 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// loggerName is the logger of the log messages sent to the MCP clients
+const loggerName = "sandbox-mcp"
+
+// clients are the MCP client sessions that can receive log messages
+var clients = &sessions{sessions: make(map[string]server.SessionWithLogging)}
+
+// sessions are the client sessions by their id
+type sessions struct {
+	mu       sync.RWMutex
+	sessions map[string]server.SessionWithLogging
+}
+
+// Hooks registers the client sessions of an MCP server to send them the logs,
+// and logs the failed requests
+// The clients receive the logs at or above the level they set with logging/setLevel
+func Hooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+		slog.Error("Request failed", "method", string(method), "id", id, "error", err)
+	})
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		if session, ok := session.(server.SessionWithLogging); ok {
+			clients.mu.Lock()
+			clients.sessions[session.SessionID()] = session
+			clients.mu.Unlock()
+		}
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		clients.mu.Lock()
+		delete(clients.sessions, session.SessionID())
+		clients.mu.Unlock()
+	})
+	return hooks
+}
+
+// enabled returns true if any client wants the logs of the level
+func (s *sessions) enabled(level slog.Level) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, session := range s.sessions {
+		if session.Initialized() && level >= FromMCPLevel(session.GetLogLevel()) {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends a log message to the clients that want the logs of the level
+// Messages are dropped for clients that are not reading their notifications
+func (s *sessions) send(level slog.Level, data map[string]any) {
+	notification := mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: "notifications/message",
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{
+					"level":  ToMCPLevel(level),
+					"logger": loggerName,
+					"data":   data,
+				},
+			},
+		},
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, session := range s.sessions {
+		if !session.Initialized() || level < FromMCPLevel(session.GetLogLevel()) {
+			continue
+		}
+		select {
+		case session.NotificationChannel() <- notification:
+		default:
+		}
+	}
+}
+
+// handler writes the log records with the next handler and sends them to the MCP clients
+type handler struct {
+	next slog.Handler
+	// attrs are the attributes added to the logger with their groups as key prefixes
+	attrs []slog.Attr
+	// prefix is the prefix of the keys of the current group
+	prefix string
+}
+
+// NewHandler returns a handler that writes the log records with next
+// and sends them to the MCP clients that set a log level
+func NewHandler(next slog.Handler) slog.Handler {
+	return &handler{next: next}
+}
+
+// Enabled returns true if the next handler or any client wants the logs of the level
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level) || clients.enabled(level)
+}
+
+// Handle writes the record with the next handler and sends it to the clients
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, record.Level) {
+		err = h.next.Handle(ctx, record)
+	}
+
+	if clients.enabled(record.Level) {
+		data := map[string]any{"message": record.Message}
+		for _, attr := range h.attrs {
+			addAttr(data, "", attr)
+		}
+		record.Attrs(func(attr slog.Attr) bool {
+			addAttr(data, h.prefix, attr)
+			return true
+		})
+		clients.send(record.Level, data)
+	}
+	return err
+}
+
+// WithAttrs returns a handler with the attributes added
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	prefixed = append(prefixed, h.attrs...)
+	for _, attr := range attrs {
+		prefixed = append(prefixed, slog.Attr{Key: h.prefix + attr.Key, Value: attr.Value})
+	}
+	return &handler{next: h.next.WithAttrs(attrs), attrs: prefixed, prefix: h.prefix}
+}
+
+// WithGroup returns a handler that adds the attributes to the group
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &handler{next: h.next.WithGroup(name), attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// addAttr adds an attribute to the data of a log message, flattening groups into dotted keys
+func addAttr(data map[string]any, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, attr := range value.Group() {
+			addAttr(data, prefix, attr)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+
+	switch v := value.Any().(type) {
+	case error:
+		data[prefix+attr.Key] = v.Error()
+	default:
+		data[prefix+attr.Key] = v
+	}
+}
+
+// ToMCPLevel returns the MCP logging level of a log level
+func ToMCPLevel(level slog.Level) mcp.LoggingLevel {
+	switch {
+	case level >= slog.LevelError+12:
+		return mcp.LoggingLevelEmergency
+	case level >= slog.LevelError+8:
+		return mcp.LoggingLevelAlert
+	case level >= slog.LevelError+4:
+		return mcp.LoggingLevelCritical
+	case level >= slog.LevelError:
+		return mcp.LoggingLevelError
+	case level >= slog.LevelWarn:
+		return mcp.LoggingLevelWarning
+	case level >= slog.LevelInfo+2:
+		return mcp.LoggingLevelNotice
+	case level >= slog.LevelInfo:
+		return mcp.LoggingLevelInfo
+	default:
+		return mcp.LoggingLevelDebug
+	}
+}
+
+// FromMCPLevel returns the log level of an MCP logging level
+// Unknown levels are error, the default level of the MCP clients
+func FromMCPLevel(level mcp.LoggingLevel) slog.Level {
+	switch mcp.LoggingLevel(strings.ToLower(string(level))) {
+	case mcp.LoggingLevelDebug:
+		return slog.LevelDebug
+	case mcp.LoggingLevelInfo:
+		return slog.LevelInfo
+	case mcp.LoggingLevelNotice:
+		return slog.LevelInfo + 2
+	case mcp.LoggingLevelWarning:
+		return slog.LevelWarn
+	case mcp.LoggingLevelCritical:
+		return slog.LevelError + 4
+	case mcp.LoggingLevelAlert:
+		return slog.LevelError + 8
+	case mcp.LoggingLevelEmergency:
+		return slog.LevelError + 12
+	default:
+		return slog.LevelError
+	}
+}
@@ -0,0 +1,92 @@
+package mcpserver
+
+import (
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/logging"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// New creates an MCP server with the tools, resources and prompts of the sandboxes
+func New(appCfg *appconfig.Config, configs map[string]*config.SandboxConfig) *server.MCPServer {
+	// Create a new MCP server
+	s := server.NewMCPServer(
+		"Sandbox MCP",
+		"0.1.0",
+		// We don't notify when the list of tools changes
+		// The list of tools never change for now
+		server.WithToolCapabilities(false),
+		// Resources are read from the sandbox directories
+		// and are not subscribable for now
+		server.WithResourceCapabilities(false, false),
+		// The prompts are read from the sandbox directories on startup
+		server.WithPromptCapabilities(false),
+		// Clients can receive the logs of the server by setting a log level
+		server.WithLogging(),
+		server.WithHooks(logging.Hooks()),
+	)
+
+	// Build or pull missing images when a sandbox is called
+	opts := []sandbox.HandlerOption{sandbox.WithImagePolicy(appCfg.ImagePolicy)}
+
+	// Create and add tools for each sandbox configuration
+	if appCfg.SandboxTools() {
+		for _, cfg := range configs {
+			// Create a new tool from the config
+			tool := sandbox.NewSandboxTool(cfg)
+
+			// Create a handler using the sandbox config
+			handler := sandbox.NewSandboxToolHandler(cfg, opts...)
+
+			// Add the tool to the server
+			s.AddTool(tool, handler)
+
+			slog.Debug("Added sandbox tool", "sandbox", cfg.Id)
+		}
+	}
+
+	// Add tools to list, describe and run any sandbox
+	if appCfg.MetaTools() {
+		s.AddTool(sandbox.NewListSandboxesTool(), sandbox.NewListSandboxesToolHandler(configs))
+		s.AddTool(sandbox.NewDescribeSandboxTool(configs), sandbox.NewDescribeSandboxToolHandler(configs))
+		s.AddTool(sandbox.NewRunSandboxTool(configs), sandbox.NewRunSandboxToolHandler(configs, opts...))
+
+		slog.Debug("Added list_sandboxes, describe_sandbox and run_sandbox tools")
+	}
+
+	// Add the config and files of each sandbox as resources
+	for _, cfg := range configs {
+		resources, err := sandbox.NewSandboxResources(cfg)
+		if err != nil {
+			slog.Error("Failed to add resources", "sandbox", cfg.Id, "error", err)
+			continue
+		}
+		for _, resource := range resources {
+			s.AddResource(resource.Resource, resource.Handler)
+		}
+
+		slog.Debug("Added resources", "sandbox", cfg.Id, "count", len(resources))
+	}
+
+	// Add a resource template for the packages installed in each sandbox
+	s.AddResourceTemplate(sandbox.NewPackagesResourceTemplate(), sandbox.NewPackagesResourceHandler(configs))
+
+	// Add the prompt templates of each sandbox
+	for _, cfg := range configs {
+		prompts, err := sandbox.NewSandboxPrompts(cfg)
+		if err != nil {
+			slog.Error("Failed to add prompts", "sandbox", cfg.Id, "error", err)
+			continue
+		}
+		for _, prompt := range prompts {
+			s.AddPrompt(prompt.Prompt, prompt.Handler)
+
+			slog.Debug("Added prompt", "sandbox", cfg.Id, "prompt", prompt.Prompt.Name)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace is the prefix of the metric names
+const namespace = "sandbox_mcp"
+
+// Path is the HTTP path the metrics are served on
+const Path = "/metrics"
+
+// registry holds the sandbox metrics and the metrics of the Go runtime and the process
+var registry = prometheus.NewRegistry()
+
+// factory registers the metrics in the registry
+var factory = promauto.With(registry)
+
+// Stages of an execution that have their own timeout
+const (
+	// StageRun is the whole execution of a sandbox
+	StageRun = "run"
+	// StageSetup is the setup command of a sandbox
+	StageSetup = "setup"
+	// StagePhase is a phase of a sandbox
+	StagePhase = "phase"
+)
+
+// Metrics of the sandbox executions by sandbox id
+var (
+	// Calls counts the tool calls of a sandbox
+	Calls = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "calls_total",
+		Help:      "Number of tool calls of a sandbox.",
+	}, []string{"sandbox"})
+	// Failures counts the tool calls that returned an error or a failed result
+	Failures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failures_total",
+		Help:      "Number of tool calls of a sandbox that returned an error or a failed result.",
+	}, []string{"sandbox"})
+	// Timeouts counts the executions stopped by a timeout by the stage that timed out
+	Timeouts = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "timeouts_total",
+		Help:      "Number of timeouts of a sandbox by stage: run, setup or phase.",
+	}, []string{"sandbox", "stage"})
+	// OOMKills counts the executions killed because they ran out of memory
+	OOMKills = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oom_kills_total",
+		Help:      "Number of executions of a sandbox killed because they ran out of memory.",
+	}, []string{"sandbox"})
+	// QueueWait is the time spent waiting for the concurrency limit
+	QueueWait = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_wait_seconds",
+		Help:      "Time spent waiting for a free slot before running a sandbox.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"sandbox"})
+	// ContainerStart is the time to create and start the container of a sandbox
+	ContainerStart = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "container_start_seconds",
+		Help:      "Time to create and start the container of a sandbox.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"sandbox"})
+	// RunDuration is the time from the start of the container to the end of the execution
+	RunDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Time from the start of the container of a sandbox to the end of the execution.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"sandbox"})
+	// Running is the number of containers of a sandbox that are running
+	Running = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "running_containers",
+		Help:      "Number of running containers of a sandbox.",
+	}, []string{"sandbox"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics on the metrics path of the address in the background
+// It returns an error if it cannot listen on the address
+func Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", "http://"+listener.Addr().String()+Path)
+	return nil
+}
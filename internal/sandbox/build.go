@@ -2,37 +2,88 @@ package sandbox
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/moby/go-archive"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
 	"github.com/pottekkat/sandbox-mcp/internal/config"
 )
 
+// contextHashLabel is the image label that stores the hash of the build context
+// It is used to skip builds when nothing changed since the image was built
+const contextHashLabel = "sandbox-mcp.context-hash"
+
+// BuildOptions configures how the image of a sandbox is built
+type BuildOptions struct {
+	// NoCache builds the image without the Docker build cache
+	// even if it is up to date
+	NoCache bool
+	// Pull pulls newer versions of the base images
+	// even if the image is up to date
+	Pull bool
+	// Output receives the build progress, defaults to stdout
+	Output io.Writer
+}
+
 // BuildImage builds the Docker image of a sandbox
-func BuildImage(ctx context.Context, sandboxConfig *config.SandboxConfig, basePath string) error {
+// It returns false without building if the image was built from the same build context
+func BuildImage(ctx context.Context, sandboxConfig *config.SandboxConfig, opts BuildOptions) (bool, error) {
 	// Initialize Docker client
-	cli, err := client.NewClientWithOpts(
-		client.FromEnv,
-		client.WithAPIVersionNegotiation(),
-	)
+	cli, err := NewDockerClient()
 	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %v", err)
+		return false, err
 	}
 	defer cli.Close()
 
-	// Get the sandbox directory which contains the Dockerfile
-	sandboxDir := filepath.Join(basePath, sandboxConfig.Id)
+	return buildImage(ctx, cli, sandboxConfig, opts)
+}
+
+// buildImage builds the Docker image of a sandbox with the given runtime
+func buildImage(ctx context.Context, cli Runtime, sandboxConfig *config.SandboxConfig, opts BuildOptions) (bool, error) {
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	// The sandbox directory contains the Dockerfile
+	// Files matched by its .dockerignore are not sent to Docker and do not change the hash
+	excludes, err := ignorePatterns(sandboxConfig.Dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to read .dockerignore: %v", err)
+	}
+	hash, err := contextHash(sandboxConfig.Dir, sandboxConfig.BuildArgs, excludes)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash build context: %v", err)
+	}
+
+	// Skip the build if the existing image was built from the same context
+	if !opts.NoCache && !opts.Pull {
+		image, err := cli.ImageInspect(ctx, sandboxConfig.Image)
+		if err == nil && image.Config != nil && image.Config.Labels[contextHashLabel] == hash {
+			fmt.Fprintf(output, "Image %s is up to date\n", sandboxConfig.Image)
+			return false, nil
+		}
+	}
 
 	// Create build context tar
-	buildCtx, err := archive.TarWithOptions(sandboxDir, &archive.TarOptions{})
+	buildCtx, err := archive.TarWithOptions(sandboxConfig.Dir, &archive.TarOptions{ExcludePatterns: excludes})
 	if err != nil {
-		return fmt.Errorf("failed to create build context: %v", err)
+		return false, fmt.Errorf("failed to create build context: %v", err)
+	}
+
+	buildArgs := make(map[string]*string, len(sandboxConfig.BuildArgs))
+	for name, value := range sandboxConfig.BuildArgs {
+		buildArgs[name] = &value
 	}
 
 	// Build the image with the specified tag
@@ -40,18 +91,116 @@ func BuildImage(ctx context.Context, sandboxConfig *config.SandboxConfig, basePa
 		Tags:       []string{sandboxConfig.Image},
 		Dockerfile: "Dockerfile",
 		Remove:     true,
+		NoCache:    opts.NoCache,
+		PullParent: opts.Pull,
+		BuildArgs:  buildArgs,
+		Labels:     map[string]string{contextHashLabel: hash},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to build image: %v", err)
+		return false, fmt.Errorf("failed to build image: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// Stream build output to stdout
-	_, err = io.Copy(os.Stdout, resp.Body)
+	// Decode the build messages into readable progress
+	// Build errors are reported as messages in the stream
+	if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, output, 0, false, nil); err != nil {
+		return false, fmt.Errorf("failed to build image: %v", err)
+	}
+
+	fmt.Fprintf(output, "Successfully built image: %s\n", sandboxConfig.Image)
+	return true, nil
+}
+
+// ignorePatterns returns the patterns of the .dockerignore file of a build context
+// The Dockerfile and the .dockerignore file are always sent, like with docker build
+func ignorePatterns(dir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	patterns, err := ignorefile.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return append(patterns, "!Dockerfile", "!.dockerignore"), nil
+}
+
+// contextHash returns a hash of the files in the build context and the build arguments
+// Files matching the exclude patterns are left out
+// Modification times are ignored so that the hash only changes with the content
+func contextHash(dir string, buildArgs map[string]string, excludes []string) (string, error) {
+	h := sha256.New()
+
+	matcher, err := patternmatcher.New(excludes)
 	if err != nil {
-		return fmt.Errorf("failed to read build output: %v", err)
+		return "", fmt.Errorf("invalid exclude patterns: %v", err)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			excluded, err := matcher.MatchesOrParentMatches(filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			// Keep walking excluded directories if an exception can include files in them
+			if excluded && entry.IsDir() && !matcher.Exclusions() {
+				return filepath.SkipDir
+			}
+			if excluded {
+				return nil
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			h.Write([]byte{0})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(buildArgs))
+	for name := range buildArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\x00", name, buildArgs[name])
 	}
 
-	log.Printf("Successfully built image: %s", sandboxConfig.Image)
-	return nil
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
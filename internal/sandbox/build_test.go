@@ -0,0 +1,117 @@
+package sandbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// writeContext creates a build context with the files and returns its directory
+func writeContext(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// hashContext returns the hash of a build context with the patterns of its .dockerignore file
+func hashContext(t *testing.T, dir string, buildArgs map[string]string) string {
+	t.Helper()
+	excludes, err := sandbox.IgnorePatterns(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := sandbox.ContextHash(dir, buildArgs, excludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestContextHash(t *testing.T) {
+	base := map[string]string{
+		"Dockerfile":       "FROM alpine\nCOPY . /app\n",
+		".dockerignore":    "*.log\ncache/\n!cache/keep.txt\n",
+		"main.sh":          "echo hello\n",
+		"app.log":          "first run\n",
+		"cache/data.bin":   "abc",
+		"cache/keep.txt":   "keep",
+		"scripts/setup.sh": "apk add curl\n",
+	}
+	baseHash := hashContext(t, writeContext(t, base), map[string]string{"VERSION": "1"})
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		buildArgs map[string]string
+		changed   bool
+	}{
+		{"same content", nil, map[string]string{"VERSION": "1"}, false},
+		{"changed file", map[string]string{"main.sh": "echo bye\n"}, map[string]string{"VERSION": "1"}, true},
+		{"added file", map[string]string{"scripts/extra.sh": ""}, map[string]string{"VERSION": "1"}, true},
+		{"changed build argument", nil, map[string]string{"VERSION": "2"}, true},
+		{"changed ignored file", map[string]string{"app.log": "second run\n"}, map[string]string{"VERSION": "1"}, false},
+		{"added file in ignored directory", map[string]string{"cache/more.bin": "def"}, map[string]string{"VERSION": "1"}, false},
+		{"changed exception of ignored directory", map[string]string{"cache/keep.txt": "changed"}, map[string]string{"VERSION": "1"}, true},
+		{"changed .dockerignore", map[string]string{".dockerignore": "*.log\n"}, map[string]string{"VERSION": "1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string, len(base))
+			for name, content := range base {
+				files[name] = content
+			}
+			for name, content := range tt.files {
+				files[name] = content
+			}
+
+			hash := hashContext(t, writeContext(t, files), tt.buildArgs)
+			if changed := hash != baseHash; changed != tt.changed {
+				t.Errorf("expected changed %v, got hash %s for base hash %s", tt.changed, hash, baseHash)
+			}
+		})
+	}
+}
+
+func TestContextHashIgnoresModificationTimes(t *testing.T) {
+	dir := writeContext(t, map[string]string{"Dockerfile": "FROM alpine\n", "main.sh": "echo hello\n"})
+	before := hashContext(t, dir, nil)
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "main.sh"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if after := hashContext(t, dir, nil); after != before {
+		t.Errorf("expected the same hash after touching a file, got %s and %s", before, after)
+	}
+}
+
+func TestIgnorePatterns(t *testing.T) {
+	// Without a .dockerignore file nothing is excluded
+	patterns, err := sandbox.IgnorePatterns(writeContext(t, map[string]string{"Dockerfile": "FROM alpine\n"}))
+	if err != nil || patterns != nil {
+		t.Errorf("expected no patterns, got %v, %v", patterns, err)
+	}
+
+	// The Dockerfile is always part of the context, even if it is ignored
+	dir := writeContext(t, map[string]string{"Dockerfile": "FROM alpine\n", ".dockerignore": "*\n", "main.sh": "echo hello\n"})
+	onlyDockerfile := writeContext(t, map[string]string{"Dockerfile": "FROM alpine\n", ".dockerignore": "*\n"})
+	if hashContext(t, dir, nil) != hashContext(t, onlyDockerfile, nil) {
+		t.Error("expected ignored files not to change the hash")
+	}
+	changed := writeContext(t, map[string]string{"Dockerfile": "FROM debian\n", ".dockerignore": "*\n"})
+	if hashContext(t, changed, nil) == hashContext(t, onlyDockerfile, nil) {
+		t.Error("expected the Dockerfile to change the hash even when ignored")
+	}
+}
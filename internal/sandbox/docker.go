@@ -0,0 +1,35 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// NewDockerClient creates a Docker client configured through the environment
+func NewDockerClient() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(
+		// Let the client be configured through environment variables
+		client.FromEnv,
+		// Try to support whatever version of the daemon is available
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %v", err)
+	}
+	return cli, nil
+}
+
+// ImageExists returns true if the image is available locally
+func ImageExists(ctx context.Context, cli Runtime, image string) (bool, error) {
+	_, err := cli.ImageInspect(ctx, image)
+	if err == nil {
+		return true, nil
+	}
+	if errdefs.IsNotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to inspect image %s: %v", image, err)
+}
@@ -0,0 +1,10 @@
+package sandbox
+
+// VerifyChecksum exposes verifyChecksum to the tests
+var VerifyChecksum = verifyChecksum
+
+// ContextHash exposes contextHash to the tests
+var ContextHash = contextHash
+
+// IgnorePatterns exposes ignorePatterns to the tests
+var IgnorePatterns = ignorePatterns
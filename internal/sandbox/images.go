@@ -0,0 +1,236 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// imageLocks makes concurrent calls wait for a single build or pull of an image
+// The images are inspected on every call instead of being cached,
+// as they can be removed at any time, like by docker image prune
+var imageLocks sync.Map
+
+// EnsureImage makes sure that an image of a sandbox exists locally according to the image policy
+// The sandbox image is built from the sandbox directory with build-if-missing,
+// and pulled from a registry with pull-if-missing. Matrix variant images are always pulled
+// Sandbox images that cannot be pulled, like the local sandbox-mcp images, are built instead
+func EnsureImage(ctx context.Context, cli Runtime, sandboxConfig *config.SandboxConfig, ref string, policy string, progress func(string)) error {
+	if policy == "" || policy == appconfig.ImagePolicyNever {
+		return nil
+	}
+	if exists, err := ImageExists(ctx, cli, ref); err != nil || exists {
+		return err
+	}
+
+	// Wait for any build or pull of the image in progress and check again
+	lock, _ := imageLocks.LoadOrStore(ref, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	exists, err := ImageExists(ctx, cli, ref)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		output := NewLineWriter(progress)
+		defer output.Flush()
+
+		if policy == appconfig.ImagePolicyBuildIfMissing && ref == sandboxConfig.Image {
+			progress(fmt.Sprintf("Image %s is missing, building it from %s", ref, sandboxConfig.Dir))
+			if _, err := buildImage(ctx, cli, sandboxConfig, BuildOptions{Output: output}); err != nil {
+				return fmt.Errorf("failed to build missing image %s: %v", ref, err)
+			}
+		} else {
+			progress(fmt.Sprintf("Image %s is missing, pulling it", ref))
+			if err := pullImage(ctx, cli, ref, output); err != nil {
+				if ref != sandboxConfig.Image {
+					return fmt.Errorf("failed to pull missing image %s: %v", ref, err)
+				}
+				if !hasDockerfile(sandboxConfig) {
+					return fmt.Errorf("failed to pull missing image %s, build it with `sandbox-mcp build %s`: %v", ref, sandboxConfig.Id, err)
+				}
+
+				// Sandbox images like sandbox-mcp/shell only exist locally
+				progress(fmt.Sprintf("Failed to pull image %s, building it from %s", ref, sandboxConfig.Dir))
+				if _, err := buildImage(ctx, cli, sandboxConfig, BuildOptions{Output: output}); err != nil {
+					return fmt.Errorf("failed to build missing image %s: %v", ref, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasDockerfile returns true if the image of a sandbox can be built from its directory
+func hasDockerfile(sandboxConfig *config.SandboxConfig) bool {
+	if sandboxConfig.Dir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(sandboxConfig.Dir, "Dockerfile"))
+	return err == nil
+}
+
+// EnsureImages checks the images of all sandboxes and builds or pulls the missing ones according to the image policy
+// With the never policy, the missing images are only reported
+func EnsureImages(ctx context.Context, configs map[string]*config.SandboxConfig, opts ...HandlerOption) {
+	options := newHandlerOptions(opts)
+	cli, closeRuntime, err := options.openRuntime()
+	if err != nil {
+		slog.Error("Failed to check sandbox images", "error", err)
+		return
+	}
+	defer closeRuntime()
+
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		sandboxConfig := configs[id]
+		for _, ref := range sandboxConfig.Images() {
+			exists, err := ImageExists(ctx, cli, ref)
+			if err != nil {
+				slog.Error("Failed to check image", "sandbox", id, "image", ref, "error", err)
+				return
+			}
+			if exists {
+				continue
+			}
+
+			if options.imagePolicy == "" || options.imagePolicy == appconfig.ImagePolicyNever {
+				slog.Warn("Image is missing, build it with `sandbox-mcp build "+id+"`", "sandbox", id, "image", ref)
+				continue
+			}
+			progress := func(message string) {
+				slog.Info(message, "sandbox", id)
+			}
+			if err := EnsureImage(ctx, cli, sandboxConfig, ref, options.imagePolicy, progress); err != nil {
+				slog.Error("Failed to prepare image", "sandbox", id, "image", ref, "error", err)
+			}
+		}
+	}
+}
+
+// ensureImages makes sure that the images needed for a tool call exist locally
+// The progress is reported to the client if it asked for progress notifications
+func ensureImages(ctx context.Context, sandboxConfig *config.SandboxConfig, request mcp.CallToolRequest, options *handlerOptions) error {
+	if options.imagePolicy == "" || options.imagePolicy == appconfig.ImagePolicyNever {
+		return nil
+	}
+
+	refs := []string{sandboxConfig.Image}
+	if sandboxConfig.HasMatrix() {
+		variants, err := selectVariants(sandboxConfig, request)
+		if err != nil {
+			return err
+		}
+		refs = refs[:0]
+		for _, variant := range variants {
+			refs = append(refs, variant.Image)
+		}
+	}
+
+	cli, closeRuntime, err := options.openRuntime()
+	if err != nil {
+		return err
+	}
+	defer closeRuntime()
+
+	progress := newProgressNotifier(ctx, request)
+	for _, ref := range refs {
+		if err := EnsureImage(ctx, cli, sandboxConfig, ref, options.imagePolicy, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newProgressNotifier returns a function that sends progress notifications to the client
+// Messages are only logged if the client did not ask for progress notifications
+func newProgressNotifier(ctx context.Context, request mcp.CallToolRequest) func(string) {
+	var token mcp.ProgressToken
+	if request.Params.Meta != nil {
+		token = request.Params.Meta.ProgressToken
+	}
+	s := server.ServerFromContext(ctx)
+
+	var progress float64
+	return func(message string) {
+		slog.Info(message, "tool", request.Params.Name)
+		if token == nil || s == nil {
+			return
+		}
+
+		progress++
+		if err := s.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+			"progressToken": token,
+			"progress":      progress,
+			"message":       message,
+		}); err != nil {
+			slog.Warn("Failed to send progress notification", "error", err)
+		}
+	}
+}
+
+// pullImage pulls an image from a registry and writes the progress to output
+func pullImage(ctx context.Context, cli Runtime, ref string, output io.Writer) error {
+	resp, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	return jsonmessage.DisplayJSONMessagesStream(resp, output, 0, false, nil)
+}
+
+// LineWriter calls a function for each non-empty line written to it
+type LineWriter struct {
+	fn  func(string)
+	buf bytes.Buffer
+}
+
+// NewLineWriter creates a writer that calls fn for each non-empty line
+func NewLineWriter(fn func(string)) *LineWriter {
+	return &LineWriter{fn: fn}
+}
+
+// Write buffers p and calls the function for all complete lines
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.emit(w.buf.Next(i + 1))
+	}
+}
+
+// Flush calls the function for the remaining incomplete line
+func (w *LineWriter) Flush() {
+	w.emit(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// emit calls the function with a line without surrounding whitespace
+func (w *LineWriter) emit(line []byte) {
+	if line = bytes.TrimSpace(line); len(line) > 0 {
+		w.fn(string(line))
+	}
+}
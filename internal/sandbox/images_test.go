@@ -0,0 +1,174 @@
+package sandbox_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox/sandboxtest"
+)
+
+// newImageConfig creates a sandbox config with an image of its own
+// The sandbox directory has a Dockerfile unless the image is only pulled
+func newImageConfig(t *testing.T, dockerfile bool) *config.SandboxConfig {
+	sandboxConfig := newConfig()
+	sandboxConfig.Image = "sandbox-mcp/" + strings.ToLower(strings.ReplaceAll(t.Name(), "/", "-")) + ":latest"
+	sandboxConfig.Dir = t.TempDir()
+	if dockerfile {
+		if err := os.WriteFile(filepath.Join(sandboxConfig.Dir, "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sandboxConfig
+}
+
+func TestEnsureImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		dockerfile bool
+		exists     bool
+		pullError  error
+		err        string
+		pulls      bool
+		builds     bool
+	}{
+		{name: "never", policy: appconfig.ImagePolicyNever, dockerfile: true},
+		{name: "exists", policy: appconfig.ImagePolicyBuildIfMissing, dockerfile: true, exists: true},
+		{name: "build", policy: appconfig.ImagePolicyBuildIfMissing, dockerfile: true, builds: true},
+		{name: "pull", policy: appconfig.ImagePolicyPullIfMissing, pulls: true},
+		{name: "build local image", policy: appconfig.ImagePolicyPullIfMissing, dockerfile: true, pullError: errors.New("pull access denied"), builds: true},
+		{name: "missing dockerfile", policy: appconfig.ImagePolicyPullIfMissing, pullError: errors.New("pull access denied"), err: "build it with `sandbox-mcp build shell`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandboxConfig := newImageConfig(t, tt.dockerfile)
+			runtime := sandboxtest.NewRuntime()
+			runtime.PullError = tt.pullError
+			if tt.exists {
+				runtime.AddImage(sandboxConfig.Image)
+			}
+
+			var messages []string
+			progress := func(message string) { messages = append(messages, message) }
+			err := sandbox.EnsureImage(context.Background(), runtime, sandboxConfig, sandboxConfig.Image, tt.policy, progress)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pulls := runtime.Pulls(); tt.pulls != slices.Equal(pulls, []string{sandboxConfig.Image}) {
+				t.Errorf("expected pulls %v, got %v", tt.pulls, pulls)
+			}
+			if builds := runtime.Builds(); tt.builds != slices.Equal(builds, []string{sandboxConfig.Image}) {
+				t.Errorf("expected builds %v, got %v", tt.builds, builds)
+			}
+			if (tt.builds || tt.pulls) && len(messages) == 0 {
+				t.Error("expected progress messages")
+			}
+
+			// The image is only prepared once
+			if err := sandbox.EnsureImage(context.Background(), runtime, sandboxConfig, sandboxConfig.Image, tt.policy, progress); err != nil {
+				t.Fatal(err)
+			}
+			if len(runtime.Pulls()) > 1 || len(runtime.Builds()) > 1 {
+				t.Errorf("expected the image to be prepared once, got pulls %v and builds %v", runtime.Pulls(), runtime.Builds())
+			}
+		})
+	}
+}
+
+func TestEnsureImages(t *testing.T) {
+	built := newImageConfig(t, true)
+	built.Id = "built"
+	existing := newImageConfig(t, true)
+	existing.Id = "existing"
+	existing.Image = strings.Replace(existing.Image, ":latest", "-existing:latest", 1)
+
+	runtime := sandboxtest.NewRuntime()
+	runtime.AddImage(existing.Image)
+
+	configs := map[string]*config.SandboxConfig{built.Id: built, existing.Id: existing}
+	sandbox.EnsureImages(context.Background(), configs, sandbox.WithRuntime(runtime), sandbox.WithImagePolicy(appconfig.ImagePolicyNever))
+	if builds := runtime.Builds(); len(builds) != 0 {
+		t.Fatalf("expected no builds with the never policy, got %v", builds)
+	}
+
+	sandbox.EnsureImages(context.Background(), configs, sandbox.WithRuntime(runtime), sandbox.WithImagePolicy(appconfig.ImagePolicyBuildIfMissing))
+	if builds := runtime.Builds(); !slices.Equal(builds, []string{built.Image}) {
+		t.Errorf("expected only the missing image to be built, got %v", builds)
+	}
+}
+
+func TestHandlerBuildsMissingImage(t *testing.T) {
+	sandboxConfig := newImageConfig(t, true)
+	runtime := sandboxtest.NewRuntime()
+
+	handler := sandbox.NewSandboxToolHandler(sandboxConfig, sandbox.WithRuntime(runtime), sandbox.WithImagePolicy(appconfig.ImagePolicyBuildIfMissing))
+	result, err := handler(context.Background(), newRequest(map[string]any{"main_sh": "echo hello"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error result: %s", resultText(result))
+	}
+	if builds := runtime.Builds(); !slices.Equal(builds, []string{sandboxConfig.Image}) {
+		t.Errorf("expected the image to be built before running, got %v", builds)
+	}
+	if containers := runtime.Containers(); len(containers) != 1 || containers[0].Config.Image != sandboxConfig.Image {
+		t.Errorf("expected one container of the built image, got %+v", containers)
+	}
+}
+
+func TestHandlerRebuildsRemovedImage(t *testing.T) {
+	sandboxConfig := newImageConfig(t, true)
+	runtime := sandboxtest.NewRuntime()
+	handler := sandbox.NewSandboxToolHandler(sandboxConfig, sandbox.WithRuntime(runtime), sandbox.WithImagePolicy(appconfig.ImagePolicyBuildIfMissing))
+
+	for i := 0; i < 2; i++ {
+		result, err := handler(context.Background(), newRequest(map[string]any{"main_sh": "echo hello"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.IsError {
+			t.Fatalf("unexpected error result: %s", resultText(result))
+		}
+
+		// The image is removed after the first call, like by docker image prune
+		runtime.RemoveImage(sandboxConfig.Image)
+	}
+	if builds := runtime.Builds(); !slices.Equal(builds, []string{sandboxConfig.Image, sandboxConfig.Image}) {
+		t.Errorf("expected the removed image to be built again, got %v", builds)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := sandbox.NewLineWriter(func(line string) { lines = append(lines, line) })
+
+	for _, p := range []string{"first\nsec", "ond\n\n  \n", "last"} {
+		if _, err := w.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(lines, []string{"first", "second"}) {
+		t.Errorf("expected the complete lines, got %q", lines)
+	}
+
+	w.Flush()
+	if !slices.Equal(lines, []string{"first", "second", "last"}) {
+		t.Errorf("expected the incomplete line after flushing, got %q", lines)
+	}
+}
@@ -0,0 +1,516 @@
+package sandbox
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// installer installs sandboxes into a staging directory first and then swaps
+// each complete sandbox into the sandboxes directory, so that a failed or
+// interrupted install never leaves a partial sandbox behind
+type installer struct {
+	destPath string
+	staging  string
+	opts     PullOptions
+	// skipped records whether each sandbox seen so far is skipped
+	skipped map[string]bool
+	// ids are the sandboxes installed into the staging directory in order
+	ids []string
+	// defaults are the defaults files shared by the sandboxes in the staging directory
+	defaults []string
+}
+
+// newInstaller creates a staging directory next to the sandboxes directory
+// It is not created inside it, as every directory there is loaded as a sandbox
+func newInstaller(destPath string, opts PullOptions) (*installer, error) {
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(filepath.Clean(destPath)), ".sandbox-mcp-staging-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	return &installer{
+		destPath: destPath,
+		staging:  staging,
+		opts:     opts,
+		skipped:  make(map[string]bool),
+	}, nil
+}
+
+// skip returns true if the entry at the path relative to the sandboxes directory is skipped
+// Sandboxes that are not selected, or that already exist unless forced, are skipped
+func (in *installer) skip(rel string) bool {
+	id, _, _ := strings.Cut(rel, "/")
+	if skip, ok := in.skipped[id]; ok {
+		return skip
+	}
+
+	skip := false
+	if strings.HasPrefix(id, ".") || !in.opts.selected(id) {
+		skip = true
+	} else if _, err := os.Lstat(filepath.Join(in.destPath, id)); err == nil && !in.opts.Force {
+		slog.Info("Skipping existing sandbox", "sandbox", id)
+		skip = true
+	}
+	in.skipped[id] = skip
+	if !skip {
+		in.ids = append(in.ids, id)
+	}
+	return skip
+}
+
+// isDefaults returns true if the path relative to the sandboxes directory is a defaults file
+// shared by the sandboxes, like defaults.json
+func isDefaults(rel string) bool {
+	return slices.Contains(config.DefaultsFiles(), rel)
+}
+
+// stageDefaults stages a defaults file unless the defaults files are left alone
+func (in *installer) stageDefaults(rel string, r io.Reader, perm fs.FileMode) error {
+	if in.opts.NoDefaults {
+		return nil
+	}
+	if err := in.writeFile(rel, r, perm); err != nil {
+		return err
+	}
+	in.defaults = append(in.defaults, rel)
+	return nil
+}
+
+// cleanPath validates a slash-separated path relative to the sandboxes directory
+// Absolute paths and paths that escape the sandboxes directory are rejected
+func cleanPath(rel string) (string, error) {
+	if rel == "" || path.IsAbs(rel) || strings.HasPrefix(rel, "\\") || filepath.VolumeName(rel) != "" {
+		return "", fmt.Errorf("illegal path %q", rel)
+	}
+	cleaned := path.Clean(rel)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("illegal path %q escapes the sandboxes directory", rel)
+	}
+	return cleaned, nil
+}
+
+// target returns the path of an entry in the staging directory
+func (in *installer) target(rel string) string {
+	return filepath.Join(in.staging, filepath.FromSlash(rel))
+}
+
+// checkParents rejects a path that goes through a symlink in the staging directory
+// Otherwise links could be chained to write outside the sandboxes directory
+func (in *installer) checkParents(rel string) error {
+	current := in.staging
+	for _, part := range strings.Split(rel, "/") {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("illegal path %q goes through a symlink", rel)
+		}
+	}
+	return nil
+}
+
+// mkdir creates a directory in the staging directory
+func (in *installer) mkdir(rel string) error {
+	if err := in.checkParents(rel); err != nil {
+		return err
+	}
+	return os.MkdirAll(in.target(rel), 0755)
+}
+
+// writeFile creates a regular file in the staging directory with the permissions of the source
+// Special bits like setuid are dropped
+func (in *installer) writeFile(rel string, r io.Reader, perm fs.FileMode) error {
+	if err := in.checkParents(path.Dir(rel)); err != nil {
+		return err
+	}
+	target := in.target(rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// The permissions passed to OpenFile are subject to the umask
+	return os.Chmod(target, perm.Perm())
+}
+
+// symlink creates a symbolic link in the staging directory
+// Only relative links that stay inside their sandbox are allowed
+func (in *installer) symlink(rel string, linkname string) error {
+	id, _, _ := strings.Cut(rel, "/")
+	if path.IsAbs(linkname) || filepath.IsAbs(linkname) {
+		return fmt.Errorf("illegal symlink %q to absolute path %q", rel, linkname)
+	}
+	resolved := path.Join(path.Dir(rel), linkname)
+	if resolved != id && !strings.HasPrefix(resolved, id+"/") {
+		return fmt.Errorf("illegal symlink %q to %q escapes its sandbox", rel, linkname)
+	}
+	if err := in.checkParents(path.Dir(rel)); err != nil {
+		return err
+	}
+
+	target := in.target(rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(linkname, target)
+}
+
+// maxLinks limits the number of symlinks followed to resolve a path, like the kernel
+const maxLinks = 40
+
+// resolve follows the symlinks of a path in the staging directory one at a time, like the kernel
+// Missing parts of the path cannot be links, so they are resolved by their name
+// It returns the resolved path relative to the staging directory
+func (in *installer) resolve(rel string) (string, error) {
+	parts := strings.Split(rel, "/")
+	resolved := ""
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "" {
+				return "", fmt.Errorf("illegal path %q escapes the sandboxes directory", rel)
+			}
+			resolved = strings.TrimSuffix(path.Dir(resolved), ".")
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		info, err := os.Lstat(in.target(next))
+		if os.IsNotExist(err) {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxLinks {
+			return "", fmt.Errorf("illegal path %q has too many levels of symlinks", rel)
+		}
+		linkname, err := os.Readlink(in.target(next))
+		if err != nil {
+			return "", err
+		}
+		linkname = filepath.ToSlash(linkname)
+		if path.IsAbs(linkname) || filepath.IsAbs(linkname) {
+			return "", fmt.Errorf("illegal symlink %q to absolute path %q", next, linkname)
+		}
+		// The link is resolved from its directory, which is the path resolved so far
+		parts = append(strings.Split(linkname, "/"), parts...)
+	}
+	return resolved, nil
+}
+
+// checkLinks rejects symlinks of a staged sandbox that resolve outside of it
+// The target of each link is checked when the link is created, but links can be
+// chained so that each target stays inside the sandbox and the result does not
+func (in *installer) checkLinks(id string) error {
+	return filepath.WalkDir(in.target(id), func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		rel, err := filepath.Rel(in.staging, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		resolved, err := in.resolve(rel)
+		if err != nil {
+			return err
+		}
+		if resolved != id && !strings.HasPrefix(resolved, id+"/") {
+			return fmt.Errorf("illegal symlink %q resolves to %q outside its sandbox", rel, resolved)
+		}
+		return nil
+	})
+}
+
+// commit swaps the staged sandboxes into the sandboxes directory and returns the installed sandboxes
+// The previous version of a sandbox is only removed once the new one is in place
+func (in *installer) commit() ([]string, error) {
+	// Check all sandboxes first so that nothing is installed from a rejected source
+	for _, id := range in.ids {
+		if _, err := os.Lstat(in.target(id)); err != nil {
+			continue
+		}
+		if err := in.checkLinks(id); err != nil {
+			return nil, err
+		}
+	}
+
+	var installed []string
+	for _, id := range in.ids {
+		staged := filepath.Join(in.staging, id)
+		info, err := os.Lstat(staged)
+		if err != nil || !info.IsDir() {
+			// Nothing but files next to the sandboxes was staged for this id
+			continue
+		}
+
+		dest := filepath.Join(in.destPath, id)
+		old := filepath.Join(in.staging, ".old-"+id)
+		replaced := false
+		if _, err := os.Lstat(dest); err == nil {
+			if err := os.Rename(dest, old); err != nil {
+				return installed, fmt.Errorf("failed to replace sandbox %s: %v", id, err)
+			}
+			replaced = true
+		}
+		if err := os.Rename(staged, dest); err != nil {
+			// Put the previous version back
+			if replaced {
+				_ = os.Rename(old, dest)
+			}
+			return installed, fmt.Errorf("failed to install sandbox %s: %v", id, err)
+		}
+		slog.Info("Installed sandbox", "sandbox", id)
+		installed = append(installed, id)
+	}
+	return installed, in.commitDefaults()
+}
+
+// commitDefaults moves the staged defaults files into the sandboxes directory
+// Existing defaults files are often edited locally, so they are only replaced if forced
+func (in *installer) commitDefaults() error {
+	if len(in.defaults) == 0 {
+		return nil
+	}
+
+	var existing []string
+	for _, name := range config.DefaultsFiles() {
+		if _, err := os.Lstat(filepath.Join(in.destPath, name)); err == nil {
+			existing = append(existing, name)
+		}
+	}
+	if len(existing) > 0 && !in.opts.Force {
+		slog.Warn("Keeping the existing defaults file, pull with --force to replace it", "path", filepath.Join(in.destPath, existing[0]), "skipped", strings.Join(in.defaults, ", "))
+		return nil
+	}
+
+	// Remove the defaults files in other formats, as only one is used
+	for _, name := range existing {
+		if !slices.Contains(in.defaults, name) {
+			if err := os.Remove(filepath.Join(in.destPath, name)); err != nil {
+				return fmt.Errorf("failed to replace defaults file %s: %v", name, err)
+			}
+		}
+	}
+	for _, name := range in.defaults {
+		if err := os.Rename(in.target(name), filepath.Join(in.destPath, name)); err != nil {
+			return fmt.Errorf("failed to install defaults file %s: %v", name, err)
+		}
+		slog.Info("Installed defaults file", "path", filepath.Join(in.destPath, name))
+	}
+	return nil
+}
+
+// cleanup removes the staging directory and the replaced sandboxes
+func (in *installer) cleanup() {
+	if err := os.RemoveAll(in.staging); err != nil {
+		slog.Warn("Failed to remove staging directory", "path", in.staging, "error", err)
+	}
+}
+
+// copySandboxes copies the sandboxes from a local directory, like a git checkout
+// The sandboxes are read from its sandboxes directory if it has one
+func copySandboxes(srcPath, destPath string, opts PullOptions) ([]string, error) {
+	if info, err := os.Stat(filepath.Join(srcPath, "sandboxes")); err == nil && info.IsDir() {
+		srcPath = filepath.Join(srcPath, "sandboxes")
+	}
+
+	in, err := newInstaller(destPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer in.cleanup()
+
+	err = filepath.WalkDir(srcPath, func(srcFile string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, srcFile)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+
+		// The defaults files are shared by all sandboxes, so they are installed with any of them
+		if entry.Type().IsRegular() && isDefaults(rel) {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(srcFile)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			return in.stageDefaults(rel, file, info.Mode())
+		}
+
+		// Skip version control metadata and unselected sandboxes
+		if entry.Name() == ".git" || in.skip(rel) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Only sandbox directories are copied, not files next to them
+		if !strings.Contains(rel, "/") && !entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return in.mkdir(rel)
+		case info.Mode().IsRegular():
+			file, err := os.Open(srcFile)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			return in.writeFile(rel, file, info.Mode())
+		case info.Mode()&fs.ModeSymlink != 0:
+			linkname, err := os.Readlink(srcFile)
+			if err != nil {
+				return err
+			}
+			return in.symlink(rel, filepath.ToSlash(linkname))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return in.commit()
+}
+
+// extractTarGz unpacks a tar.gz archive to the specified path
+// Archives of releases have the sandboxes in a sandboxes directory, other archives may have them at the root
+func extractTarGz(srcPath, destPath string, opts PullOptions) ([]string, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Set up gzip reader
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+
+	in, err := newInstaller(destPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer in.cleanup()
+
+	// Read tar archive
+	tr := tar.NewReader(gzr)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Reject entries that would be written outside the sandboxes directory
+		name, err := cleanPath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Get path relative to sandboxes directory
+		rel := strings.TrimPrefix(name, "sandboxes/")
+		if name == "." || name == "sandboxes" {
+			continue
+		}
+
+		// The defaults files are shared by all sandboxes, so they are installed with any of them
+		if header.Typeflag == tar.TypeReg && isDefaults(rel) {
+			if err := in.stageDefaults(rel, tr, header.FileInfo().Mode()); err != nil {
+				return nil, fmt.Errorf("failed to extract %s: %v", header.Name, err)
+			}
+			continue
+		}
+
+		// Skip unselected and existing sandboxes unless force is true
+		if in.skip(rel) {
+			continue
+		}
+
+		// Only sandbox directories are extracted, not files next to them
+		if !strings.Contains(rel, "/") && header.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		// Handle directories, files and links
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = in.mkdir(rel)
+		case tar.TypeReg:
+			err = in.writeFile(rel, tr, header.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = in.symlink(rel, header.Linkname)
+		default:
+			slog.Warn("Skipping unsupported archive entry", "entry", header.Name, "type", string(header.Typeflag))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %v", header.Name, err)
+		}
+	}
+
+	return in.commit()
+}
@@ -0,0 +1,32 @@
+package sandbox
+
+import "context"
+
+// limiter bounds the number of sandboxes running at the same time
+// A nil limiter does not limit anything
+var limiter chan struct{}
+
+// SetMaxConcurrency sets the maximum number of sandboxes running at the same time
+// Zero or a negative value removes the limit
+// It should be called before any sandbox is run
+func SetMaxConcurrency(n int) {
+	if n <= 0 {
+		limiter = nil
+		return
+	}
+	limiter = make(chan struct{}, n)
+}
+
+// acquire waits for a free slot to run a sandbox and returns a function to release it
+func acquire(ctx context.Context) (func(), error) {
+	if limiter == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case limiter <- struct{}{}:
+		return func() { <-limiter }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,175 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+const (
+	// stateDir stores the lockfile and the installed versions of the sandboxes
+	// It is hidden so that it is not loaded as a sandbox
+	stateDir = ".sandbox-mcp"
+	// lockFileName is the name of the lockfile in the state directory
+	lockFileName = "lock.json"
+	// baseDir stores a copy of each sandbox as it was installed, to detect
+	// local modifications and to merge them with upstream changes
+	baseDir = "base"
+)
+
+// LockEntry records the version of a sandbox that was installed
+type LockEntry struct {
+	// Version is the version from the config file of the sandbox
+	Version string `json:"version"`
+	// Source is the URL of the source the sandbox was installed from
+	Source string `json:"source"`
+	// Hash is the hash of the installed sandbox directory
+	Hash string `json:"hash"`
+	// InstalledAt is the time the sandbox was installed
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+// Lockfile records the installed sandboxes
+type Lockfile struct {
+	Sandboxes map[string]LockEntry `json:"sandboxes"`
+}
+
+// lockPath returns the path of the lockfile in the sandboxes directory
+func lockPath(sandboxesPath string) string {
+	return filepath.Join(sandboxesPath, stateDir, lockFileName)
+}
+
+// basePath returns the path of the installed copy of a sandbox
+func basePath(sandboxesPath string, id string) string {
+	return filepath.Join(sandboxesPath, stateDir, baseDir, id)
+}
+
+// LoadLockfile reads the lockfile of the sandboxes directory
+// It returns an empty lockfile if none exists yet
+func LoadLockfile(sandboxesPath string) (*Lockfile, error) {
+	lock := &Lockfile{Sandboxes: make(map[string]LockEntry)}
+
+	data, err := os.ReadFile(lockPath(sandboxesPath))
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %v", err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile: %v", err)
+	}
+	if lock.Sandboxes == nil {
+		lock.Sandboxes = make(map[string]LockEntry)
+	}
+	return lock, nil
+}
+
+// Save writes the lockfile to the sandboxes directory
+func (l *Lockfile) Save(sandboxesPath string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(lockPath(sandboxesPath)), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(lockPath(sandboxesPath), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %v", err)
+	}
+	return nil
+}
+
+// Record records that a sandbox was installed from the upstream directory
+// and keeps a copy of it as the base for detecting local modifications
+func (l *Lockfile) Record(sandboxesPath string, id string, source string, upstreamDir string) error {
+	hash, err := contextHash(upstreamDir, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to hash sandbox %s: %v", id, err)
+	}
+
+	base := basePath(sandboxesPath, id)
+	if err := os.RemoveAll(base); err != nil {
+		return fmt.Errorf("failed to remove the previous copy of sandbox %s: %v", id, err)
+	}
+	if err := copyDir(upstreamDir, base); err != nil {
+		return fmt.Errorf("failed to keep a copy of sandbox %s: %v", id, err)
+	}
+
+	l.Sandboxes[id] = LockEntry{
+		Version:     sandboxVersion(upstreamDir),
+		Source:      source,
+		Hash:        hash,
+		InstalledAt: time.Now().UTC(),
+	}
+	return nil
+}
+
+// sandboxVersion returns the version from the config file in a sandbox directory
+func sandboxVersion(dir string) string {
+	cfg, err := config.LoadSandboxConfig(dir)
+	if err != nil {
+		return ""
+	}
+	return cfg.Version
+}
+
+// copyDir copies a directory with its files, permissions and symlinks
+func copyDir(srcPath, destPath string) error {
+	return filepath.WalkDir(srcPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destPath, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&fs.ModeSymlink != 0:
+			linkname, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkname, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+// copyFile copies a regular file with the given permissions
+func copyFile(srcPath, destPath string, perm os.FileMode) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+		return err
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(destPath, perm)
+}
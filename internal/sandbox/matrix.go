@@ -0,0 +1,128 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// variantResult holds the outcome of running a sandbox on a single variant
+type variantResult struct {
+	Label   string `json:"label"`
+	Image   string `json:"image"`
+	IsError bool   `json:"isError"`
+	text    string
+}
+
+// withVariants creates a parameter to select the matrix variants to run
+func withVariants(sandboxConfig *config.SandboxConfig) mcp.ToolOption {
+	labels := make([]string, 0, len(sandboxConfig.Matrix))
+	for _, variant := range sandboxConfig.Matrix {
+		labels = append(labels, variant.Label)
+	}
+
+	return mcp.WithArray("variants",
+		mcp.Description("Variants to run the code on. Runs on all variants if not provided."),
+		mcp.Items(map[string]any{
+			"type": "string",
+			"enum": labels,
+		}),
+	)
+}
+
+// selectVariants returns the variants requested by the client or all variants if none are requested
+func selectVariants(sandboxConfig *config.SandboxConfig, request mcp.CallToolRequest) ([]config.SandboxVariant, error) {
+	requested, ok := request.Params.Arguments["variants"].([]any)
+	if !ok || len(requested) == 0 {
+		return sandboxConfig.Matrix, nil
+	}
+
+	variants := make([]config.SandboxVariant, 0, len(requested))
+	for _, item := range requested {
+		label, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("variants must be a list of strings")
+		}
+		variant, ok := sandboxConfig.Variant(label)
+		if !ok {
+			return nil, fmt.Errorf("unknown variant %q", label)
+		}
+		variants = append(variants, *variant)
+	}
+	return variants, nil
+}
+
+// runMatrix runs a sandbox concurrently on the selected variants and returns a per-variant result table
+// Each variant runs in its own sandbox, so the concurrency limit applies to each of them
+func runMatrix(ctx context.Context, sandboxConfig *config.SandboxConfig, request mcp.CallToolRequest, options *handlerOptions) (*mcp.CallToolResult, error) {
+	variants, err := selectVariants(sandboxConfig, request)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]variantResult, len(variants))
+	var wg sync.WaitGroup
+	for i, variant := range variants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Run a copy of the sandbox with the image of the variant
+			variantConfig := *sandboxConfig
+			variantConfig.Image = variant.Image
+			variantConfig.Matrix = nil
+
+			results[i] = variantResult{Label: variant.Label, Image: variant.Image}
+			result, err := runSandbox(ctx, &variantConfig, request, options)
+			if err != nil {
+				results[i].IsError = true
+				results[i].text = err.Error()
+				return
+			}
+			results[i].IsError = result.IsError
+			results[i].text = resultText(result)
+		}()
+	}
+	wg.Wait()
+
+	// Summarize the results in a table followed by the output of each variant
+	var table strings.Builder
+	table.WriteString("| Variant | Image | Result |\n|---------|-------|--------|\n")
+	isError := false
+	for _, result := range results {
+		status := "passed"
+		if result.IsError {
+			status = "failed"
+			isError = true
+		}
+		fmt.Fprintf(&table, "| %s | `%s` | %s |\n", result.Label, result.Image, status)
+	}
+
+	content := []mcp.Content{mcp.NewTextContent(table.String())}
+	for _, result := range results {
+		content = append(content, mcp.NewTextContent(fmt.Sprintf("Variant `%s`:\n%s", result.Label, result.text)))
+	}
+
+	return &mcp.CallToolResult{
+		Result: mcp.Result{
+			Meta: map[string]any{"variants": results},
+		},
+		Content: content,
+		IsError: isError,
+	}, nil
+}
+
+// resultText joins the text contents of a tool result
+func resultText(result *mcp.CallToolResult) string {
+	texts := make([]string, 0, len(result.Content))
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,228 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// sortedIds returns the ids of the sandboxes in alphabetical order
+func sortedIds(configs map[string]*config.SandboxConfig) []string {
+	ids := make([]string, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// withSandbox creates a parameter to select a sandbox by its id
+func withSandbox(configs map[string]*config.SandboxConfig) mcp.ToolOption {
+	return mcp.WithString("sandbox",
+		mcp.Required(),
+		mcp.Description("Id of the sandbox as returned by `list_sandboxes`"),
+		mcp.Enum(sortedIds(configs)...),
+	)
+}
+
+// lookupSandbox returns the config of the sandbox selected in the request
+func lookupSandbox(configs map[string]*config.SandboxConfig, request mcp.CallToolRequest) (*config.SandboxConfig, error) {
+	id, ok := request.Params.Arguments["sandbox"].(string)
+	if !ok || id == "" {
+		return nil, fmt.Errorf("sandbox is required")
+	}
+	sandboxConfig, ok := configs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown sandbox %q, call list_sandboxes to see the available sandboxes", id)
+	}
+	return sandboxConfig, nil
+}
+
+// NewListSandboxesTool creates a tool that lists the available sandboxes
+func NewListSandboxesTool() mcp.Tool {
+	return mcp.NewTool("list_sandboxes",
+		mcp.WithDescription("List the available sandboxes with their ids and descriptions. Use `describe_sandbox` to learn how to run a sandbox and `run_sandbox` to run it."),
+		mcp.WithTitleAnnotation("List Sandboxes"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+}
+
+// NewListSandboxesToolHandler creates a handler function for the list_sandboxes tool
+func NewListSandboxesToolHandler(configs map[string]*config.SandboxConfig) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var b strings.Builder
+		for _, id := range sortedIds(configs) {
+			sandboxConfig := configs[id]
+			fmt.Fprintf(&b, "- `%s` (%s): %s\n", id, sandboxConfig.Name(), sandboxConfig.Description)
+		}
+		return mcp.NewToolResultText(b.String()), nil
+	}
+}
+
+// NewDescribeSandboxTool creates a tool that describes a sandbox and its parameters
+func NewDescribeSandboxTool(configs map[string]*config.SandboxConfig) mcp.Tool {
+	return mcp.NewTool("describe_sandbox",
+		mcp.WithDescription("Describe a sandbox, including its environment, the files it requires and the JSON schema of its parameters."),
+		withSandbox(configs),
+		mcp.WithTitleAnnotation("Describe Sandbox"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+}
+
+// NewDescribeSandboxToolHandler creates a handler function for the describe_sandbox tool
+func NewDescribeSandboxToolHandler(configs map[string]*config.SandboxConfig) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sandboxConfig, err := lookupSandbox(configs, request)
+		if err != nil {
+			return nil, err
+		}
+
+		// Describe the sandbox the same way as its own tool
+		tool := NewSandboxTool(sandboxConfig)
+		schema, err := json.MarshalIndent(tool.InputSchema, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal the sandbox parameters: %v", err)
+		}
+
+		description := fmt.Sprintf("%s\n\nThe entrypoint file `%s` is required. Pass it and any other files in the `files` parameter of `run_sandbox`. The sandbox accepts the following parameters:\n\n```json\n%s\n```",
+			tool.Description,
+			sandboxConfig.Entrypoint,
+			schema)
+		return mcp.NewToolResultText(description), nil
+	}
+}
+
+// NewRunSandboxTool creates a tool that runs any of the sandboxes
+func NewRunSandboxTool(configs map[string]*config.SandboxConfig) mcp.Tool {
+	return mcp.NewTool("run_sandbox",
+		mcp.WithDescription("Run code in a sandbox. The files must include the entrypoint and the required files of the sandbox as returned by `describe_sandbox`."),
+		withSandbox(configs),
+		mcp.WithArray("files",
+			mcp.Required(),
+			mcp.Description("Files to be included in the sandbox, including the entrypoint"),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"filename": map[string]any{
+						"type": "string",
+					},
+					"content": map[string]any{
+						"type": "string",
+					},
+				},
+				"required": []string{"filename", "content"},
+			}),
+		),
+		mcp.WithArray("variants",
+			mcp.Description("Variants to run the code on if the sandbox has a matrix. Runs on all variants if not provided."),
+			mcp.Items(map[string]any{
+				"type": "string",
+			}),
+		),
+		mcp.WithTitleAnnotation("Run Sandbox"),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+	)
+}
+
+// NewRunSandboxToolHandler creates a handler function for the run_sandbox tool
+// The files are validated against the selected sandbox and passed to its handler
+func NewRunSandboxToolHandler(configs map[string]*config.SandboxConfig, opts ...HandlerOption) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sandboxConfig, err := lookupSandbox(configs, request)
+		if err != nil {
+			return nil, err
+		}
+
+		arguments, err := sandboxArguments(sandboxConfig, request)
+		if err != nil {
+			return nil, err
+		}
+
+		// Run the sandbox as if its own tool was called
+		sandboxRequest := request
+		sandboxRequest.Params.Name = sandboxConfig.Id
+		sandboxRequest.Params.Arguments = arguments
+		return NewSandboxToolHandler(sandboxConfig, opts...)(ctx, sandboxRequest)
+	}
+}
+
+// sandboxArguments converts the arguments of run_sandbox to the arguments of a sandbox tool
+func sandboxArguments(sandboxConfig *config.SandboxConfig, request mcp.CallToolRequest) (map[string]any, error) {
+	files, ok := request.Params.Arguments["files"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("files must be a list of objects with a filename and content")
+	}
+
+	// Map the entrypoint and the required files to their parameters
+	params := map[string]string{
+		sandboxConfig.Entrypoint: sandboxConfig.ParamEntrypoint(),
+	}
+	for _, file := range sandboxConfig.Parameters.Files {
+		params[file.Name] = file.ParamName()
+	}
+
+	arguments := make(map[string]any)
+	var additionalFiles []any
+	for _, file := range files {
+		fileMap, ok := file.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("files must be a list of objects with a filename and content")
+		}
+		filename, ok := fileMap["filename"].(string)
+		if !ok || filename == "" {
+			return nil, fmt.Errorf("each file requires a filename")
+		}
+		content, ok := fileMap["content"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s file requires a content", filename)
+		}
+
+		if param, ok := params[filename]; ok {
+			arguments[param] = content
+			continue
+		}
+		if !sandboxConfig.Parameters.AdditionalFiles {
+			return nil, fmt.Errorf("sandbox %s does not accept the additional file %s", sandboxConfig.Id, filename)
+		}
+		additionalFiles = append(additionalFiles, fileMap)
+	}
+
+	// Check that the entrypoint and all required files are present
+	required := []string{sandboxConfig.Entrypoint}
+	for _, file := range sandboxConfig.Parameters.Files {
+		required = append(required, file.Name)
+	}
+	for _, filename := range required {
+		if _, ok := arguments[params[filename]]; !ok {
+			return nil, fmt.Errorf("%s file is required by sandbox %s", filename, sandboxConfig.Id)
+		}
+	}
+
+	if len(additionalFiles) > 0 {
+		arguments["files"] = additionalFiles
+	}
+
+	// Pass the variants through to sandboxes with a matrix
+	if variants, ok := request.Params.Arguments["variants"]; ok {
+		if !sandboxConfig.HasMatrix() {
+			return nil, fmt.Errorf("sandbox %s does not have variants", sandboxConfig.Id)
+		}
+		arguments["variants"] = variants
+	}
+
+	return arguments, nil
+}
@@ -0,0 +1,117 @@
+package sandbox_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox/sandboxtest"
+)
+
+// newConfigs creates the shell sandbox and a copy of it with another id
+func newConfigs() map[string]*config.SandboxConfig {
+	shell := newConfig()
+	shell.Description = "Run shell scripts"
+	other := newConfig()
+	other.Id = "another-shell"
+	other.Image = "sandbox-mcp/another-shell:latest"
+	other.Description = "Run other shell scripts"
+	return map[string]*config.SandboxConfig{shell.Id: shell, other.Id: other}
+}
+
+// newMetaRequest creates a tool call request for a meta tool
+func newMetaRequest(name string, arguments map[string]any) mcp.CallToolRequest {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = arguments
+	return request
+}
+
+func TestListSandboxes(t *testing.T) {
+	result, err := sandbox.NewListSandboxesToolHandler(newConfigs())(context.Background(), newMetaRequest("list_sandboxes", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := resultText(result)
+	first := strings.Index(text, "- `another-shell`")
+	second := strings.Index(text, "- `shell`")
+	if first < 0 || second < first || !strings.Contains(text, "Run shell scripts") {
+		t.Errorf("expected the sandboxes in alphabetical order with their descriptions, got %q", text)
+	}
+}
+
+func TestDescribeSandbox(t *testing.T) {
+	handler := sandbox.NewDescribeSandboxToolHandler(newConfigs())
+	result, err := handler(context.Background(), newMetaRequest("describe_sandbox", map[string]any{"sandbox": "shell"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := resultText(result)
+	for _, expected := range []string{"The entrypoint file `main.sh` is required", `"main_sh"`, "```json"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in the description, got %q", expected, text)
+		}
+	}
+}
+
+func TestRunSandbox(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Default = sandboxtest.Script{Stdout: "hello\n"}
+	handler := sandbox.NewRunSandboxToolHandler(newConfigs(), sandbox.WithRuntime(runtime))
+
+	result, err := handler(context.Background(), newMetaRequest("run_sandbox", map[string]any{
+		"sandbox": "another-shell",
+		"files":   []any{map[string]any{"filename": "main.sh", "content": "echo hello"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError || !strings.Contains(resultText(result), "hello") {
+		t.Errorf("expected the output of the sandbox, got %q", resultText(result))
+	}
+
+	containers := runtime.Containers()
+	if len(containers) != 1 || containers[0].Config.Image != "sandbox-mcp/another-shell:latest" {
+		t.Fatalf("expected one container of the selected sandbox, got %+v", containers)
+	}
+	if files := containers[0].Files; len(files) != 1 || files[0] != "main.sh" {
+		t.Errorf("expected the entrypoint in the working directory, got %v", files)
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestMetaToolErrors(t *testing.T) {
+	configs := newConfigs()
+	handlers := map[string]func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+		"describe_sandbox": sandbox.NewDescribeSandboxToolHandler(configs),
+		"run_sandbox":      sandbox.NewRunSandboxToolHandler(configs, sandbox.WithRuntime(sandboxtest.NewRuntime())),
+	}
+	mainSh := map[string]any{"filename": "main.sh", "content": "echo hello"}
+
+	tests := []struct {
+		name      string
+		tool      string
+		arguments map[string]any
+		err       string
+	}{
+		{"describe unknown id", "describe_sandbox", map[string]any{"sandbox": "ruby"}, `unknown sandbox "ruby"`},
+		{"describe without id", "describe_sandbox", map[string]any{}, "sandbox is required"},
+		{"run unknown id", "run_sandbox", map[string]any{"sandbox": "ruby", "files": []any{mainSh}}, `unknown sandbox "ruby"`},
+		{"run without entrypoint", "run_sandbox", map[string]any{"sandbox": "shell", "files": []any{}}, "main.sh file is required"},
+		{"run with additional file", "run_sandbox", map[string]any{"sandbox": "shell", "files": []any{mainSh, map[string]any{"filename": "extra.sh", "content": ""}}}, "does not accept the additional file extra.sh"},
+		{"run with variants", "run_sandbox", map[string]any{"sandbox": "shell", "files": []any{mainSh}, "variants": []any{"3.12"}}, "does not have variants"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := handlers[tt.tool](context.Background(), newMetaRequest(tt.tool, tt.arguments))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package sandbox_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/metrics"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox/sandboxtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestHandlerRecordsMetrics(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Default = sandboxtest.Script{ExitCode: 137, OOMKilled: true}
+
+	// Use an id of its own so that other tests don't change the metrics
+	sandboxConfig := newConfig()
+	sandboxConfig.Id = "metrics-oom"
+
+	if _, err := callHandler(t, sandboxConfig, runtime, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callHandler(t, sandboxConfig, runtime, map[string]any{}); err == nil {
+		t.Fatal("expected an error without the entrypoint")
+	}
+
+	expected := map[string]float64{
+		"calls":    2,
+		"failures": 2,
+		"ooms":     1,
+		"timeouts": 0,
+		"running":  0,
+	}
+	got := map[string]float64{
+		"calls":    testutil.ToFloat64(metrics.Calls.WithLabelValues(sandboxConfig.Id)),
+		"failures": testutil.ToFloat64(metrics.Failures.WithLabelValues(sandboxConfig.Id)),
+		"ooms":     testutil.ToFloat64(metrics.OOMKills.WithLabelValues(sandboxConfig.Id)),
+		"timeouts": testutil.ToFloat64(metrics.Timeouts.WithLabelValues(sandboxConfig.Id, metrics.StageRun)),
+		"running":  testutil.ToFloat64(metrics.Running.WithLabelValues(sandboxConfig.Id)),
+	}
+	for name, value := range expected {
+		if got[name] != value {
+			t.Errorf("expected %s to be %v, got %v", name, value, got[name])
+		}
+	}
+
+	// Only the call that ran a container is in the container histograms
+	histograms := map[string]*prometheus.HistogramVec{
+		"queue wait":      metrics.QueueWait,
+		"container start": metrics.ContainerStart,
+		"run duration":    metrics.RunDuration,
+	}
+	for name, histogram := range histograms {
+		var metric dto.Metric
+		if err := histogram.WithLabelValues(sandboxConfig.Id).(prometheus.Histogram).Write(&metric); err != nil {
+			t.Fatal(err)
+		}
+		if count := metric.GetHistogram().GetSampleCount(); count != 1 {
+			t.Errorf("expected one %s observation, got %d", name, count)
+		}
+	}
+}
+
+func TestHandlerRecordsTimeoutsByStage(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"sleep", "infinity"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"install"}, sandboxtest.Script{Delay: time.Minute})
+	runtime.Script([]string{"serve"}, sandboxtest.Script{Delay: time.Minute})
+	runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{Delay: time.Minute})
+
+	// Use ids of their own so that other tests don't change the metrics
+	setup := newConfig()
+	setup.Id = "metrics-setup-timeout"
+	setup.Setup = &config.SandboxSetup{Command: []string{"install"}, TimeoutRaw: 1}
+	phase := newConfig()
+	phase.Id = "metrics-phase-timeout"
+	phase.Phases = []config.SandboxPhase{{Name: "serve", Command: []string{"serve"}, TimeoutRaw: 1}}
+	run := newConfig()
+	run.Id = "metrics-run-timeout"
+	run.TimeoutRaw = 1
+
+	if _, err := callHandler(t, setup, runtime, nil); err == nil {
+		t.Error("expected a setup timeout error")
+	}
+	if _, err := callHandler(t, phase, runtime, nil); err != nil {
+		t.Errorf("expected a timed out phase in the result, got %v", err)
+	}
+	if _, err := callHandler(t, run, runtime, nil); err == nil {
+		t.Error("expected an execution timeout error")
+	}
+
+	// Each timeout is only counted for the stage that timed out
+	for _, sandboxConfig := range []*config.SandboxConfig{setup, phase, run} {
+		expected := map[string]float64{metrics.StageRun: 0, metrics.StageSetup: 0, metrics.StagePhase: 0}
+		switch sandboxConfig {
+		case setup:
+			expected[metrics.StageSetup] = 1
+		case phase:
+			expected[metrics.StagePhase] = 1
+		case run:
+			expected[metrics.StageRun] = 1
+		}
+		for stage, value := range expected {
+			if got := testutil.ToFloat64(metrics.Timeouts.WithLabelValues(sandboxConfig.Id, stage)); got != value {
+				t.Errorf("expected %v %s timeouts of %s, got %v", value, stage, sandboxConfig.Id, got)
+			}
+		}
+	}
+	assertCleanedUp(t, runtime)
+}
@@ -0,0 +1,278 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/metrics"
+)
+
+// Possible outcomes of a phase
+const (
+	phaseSucceeded = "succeeded"
+	phaseFailed    = "failed"
+	phaseTimedOut  = "timedOut"
+	phaseSkipped   = "skipped"
+)
+
+// timeoutExitCode is the exit code of a timed out phase, like with timeout(1)
+const timeoutExitCode = 124
+
+// phaseResult holds the outcome of a single phase
+type phaseResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	ExitCode int    `json:"exitCode"`
+	stdout   string
+	stderr   string
+	timeout  time.Duration
+}
+
+// execInContainer runs a command in a running container and returns its output and exit code
+func execInContainer(ctx context.Context, cli Runtime, containerID string, cmd []string, user string) (*bytes.Buffer, *bytes.Buffer, int, error) {
+	execConfig := container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+		User:         user,
+	}
+
+	execResp, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to create exec: %v", err)
+	}
+
+	// Attach to the exec command to capture output
+	response, err := cli.ContainerExecAttach(ctx, execResp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to attach to exec: %v", err)
+	}
+	defer response.Close()
+
+	// Reading the output blocks until the command exits
+	// Close the connection when the context is done to stop waiting
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			response.Close()
+		case <-done:
+		}
+	}()
+
+	// Read stdout and stderr from the exec command
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(stdout, stderr, response.Reader); err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, 0, ctx.Err()
+		}
+		return nil, nil, 0, fmt.Errorf("failed to read exec output: %v", err)
+	}
+
+	// Wait for the exec command to complete
+	for {
+		inspectResp, err := cli.ContainerExecInspect(ctx, execResp.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, 0, ctx.Err()
+			}
+			return nil, nil, 0, fmt.Errorf("failed to inspect exec: %v", err)
+		}
+		if !inspectResp.Running {
+			return stdout, stderr, inspectResp.ExitCode, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// isolatedNetwork is an internal network without egress that sandboxes without a network are created on
+// when their phases need a network, as Docker cannot connect a container created without a network later
+const isolatedNetwork = "sandbox-mcp-isolated"
+
+// isolatedNetworkLock makes concurrent sandboxes wait for a single creation of the isolated network
+var isolatedNetworkLock sync.Mutex
+
+// ensureIsolatedNetwork creates the isolated network if it does not exist
+// The containers on the network can neither reach other networks nor each other
+func ensureIsolatedNetwork(ctx context.Context, cli Runtime) error {
+	isolatedNetworkLock.Lock()
+	defer isolatedNetworkLock.Unlock()
+
+	_, err := cli.NetworkInspect(ctx, isolatedNetwork, network.InspectOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to inspect network %s: %v", isolatedNetwork, err)
+	}
+
+	_, err = cli.NetworkCreate(ctx, isolatedNetwork, network.CreateOptions{
+		Driver:   "bridge",
+		Internal: true,
+		Options:  map[string]string{"com.docker.network.bridge.enable_icc": "false"},
+	})
+	// Another sandbox-mcp process may have created the network in the meantime
+	if err != nil && !errdefs.IsConflict(err) {
+		return fmt.Errorf("failed to create network %s: %v", isolatedNetwork, err)
+	}
+	return nil
+}
+
+// sandboxNetwork returns the network mode the sandbox container is created with
+// Sandboxes without a network whose phases need one are created on the isolated network
+// and disconnected from it before they start, so that they can be connected to the networks of the phases
+func sandboxNetwork(ctx context.Context, cli Runtime, sandboxConfig *config.SandboxConfig) (string, error) {
+	if !sandboxConfig.HasPhases() || sandboxConfig.Security.Network != "none" || !sandboxConfig.PhasesNeedNetwork() {
+		return sandboxConfig.Security.Network, nil
+	}
+	if err := ensureIsolatedNetwork(ctx, cli); err != nil {
+		return "", err
+	}
+	return isolatedNetwork, nil
+}
+
+// switchNetwork moves a container from its current network to the given network
+// A network mode of "none" means that the container is not connected to any network
+func switchNetwork(ctx context.Context, cli Runtime, containerID string, current string, target string) error {
+	if current == target {
+		return nil
+	}
+	if current != "none" {
+		if err := cli.NetworkDisconnect(ctx, current, containerID, true); err != nil {
+			return fmt.Errorf("failed to disconnect from network %s: %v", current, err)
+		}
+	}
+	if target != "none" {
+		if err := cli.NetworkConnect(ctx, target, containerID, nil); err != nil {
+			return fmt.Errorf("failed to connect to network %s: %v", target, err)
+		}
+	}
+	return nil
+}
+
+// runPhases executes the phases of a sandbox one after the other in a running container
+// A failing phase stops the pipeline unless it is marked to continue on error
+// A timed out phase always stops the pipeline, as Docker cannot stop an exec and
+// the command keeps running until the container is removed
+func runPhases(ctx context.Context, cli Runtime, sandboxConfig *config.SandboxConfig, containerID string) (*mcp.CallToolResult, error) {
+	results := make([]phaseResult, 0, len(sandboxConfig.Phases))
+	// The sandbox starts with its own network, sandboxes on the isolated network are disconnected from it
+	current := sandboxConfig.Security.Network
+	// stop skips the remaining phases, and failed records whether any phase did not succeed
+	stop, failed := false, false
+
+	for i := range sandboxConfig.Phases {
+		phase := &sandboxConfig.Phases[i]
+		result := phaseResult{Name: phaseName(phase, i), timeout: phase.Timeout()}
+
+		// Skip the remaining phases after a failure
+		if stop {
+			result.Status = phaseSkipped
+			results = append(results, result)
+			continue
+		}
+
+		// Switch to the network of the phase
+		// The network belongs to the container, so background processes
+		// started by earlier phases are moved to it as well
+		phaseNetwork := sandboxConfig.PhaseNetwork(phase)
+		if err := switchNetwork(ctx, cli, containerID, current, phaseNetwork); err != nil {
+			return nil, err
+		}
+		current = phaseNetwork
+
+		// Each phase can have its own timeout within the sandbox timeout
+		phaseCtx, cancel := ctx, context.CancelFunc(func() {})
+		if phase.TimeoutRaw > 0 {
+			phaseCtx, cancel = context.WithTimeout(ctx, phase.Timeout())
+		}
+
+		stdout, stderr, exitCode, err := execInContainer(phaseCtx, cli, containerID, phase.Command, sandboxConfig.User)
+		cancel()
+		switch {
+		case err != nil && phaseCtx.Err() != nil && ctx.Err() == nil:
+			result.Status = phaseTimedOut
+			result.ExitCode = timeoutExitCode
+			metrics.Timeouts.WithLabelValues(sandboxConfig.Id, metrics.StagePhase).Inc()
+		case err != nil:
+			return nil, err
+		case exitCode != 0:
+			result.Status = phaseFailed
+			result.ExitCode = exitCode
+		default:
+			result.Status = phaseSucceeded
+		}
+		if stdout != nil {
+			result.stdout = stdout.String()
+			result.stderr = stderr.String()
+		}
+
+		if result.Status != phaseSucceeded {
+			failed = true
+			stop = stop || !phase.ContinueOnError || result.Status == phaseTimedOut
+		}
+		results = append(results, result)
+	}
+
+	// Return the output of each phase as a separate content
+	content := make([]mcp.Content, 0, len(results))
+	for _, result := range results {
+		content = append(content, mcp.NewTextContent(formatPhaseResult(result)))
+	}
+
+	return &mcp.CallToolResult{
+		Result: mcp.Result{
+			Meta: map[string]any{"phases": results},
+		},
+		Content: content,
+		IsError: failed,
+	}, nil
+}
+
+// phaseName returns the name of a phase or its position if it has no name
+func phaseName(phase *config.SandboxPhase, index int) string {
+	if phase.Name != "" {
+		return phase.Name
+	}
+	return fmt.Sprintf("%d", index+1)
+}
+
+// formatPhaseResult creates a readable summary of a phase and its output
+func formatPhaseResult(result phaseResult) string {
+	var b strings.Builder
+
+	switch result.Status {
+	case phaseSkipped:
+		fmt.Fprintf(&b, "Phase `%s` was skipped because a previous phase failed or timed out.", result.Name)
+		return b.String()
+	case phaseTimedOut:
+		fmt.Fprintf(&b, "Phase `%s` timed out after %d seconds.", result.Name, int(result.timeout.Seconds()))
+	default:
+		fmt.Fprintf(&b, "Phase `%s` exited with code %d.", result.Name, result.ExitCode)
+	}
+
+	if result.stdout != "" {
+		b.WriteString("\n")
+		b.WriteString(result.stdout)
+	}
+
+	// Include stderr after stdout if present
+	if result.stderr != "" {
+		b.WriteString("\nStderr:\n")
+		b.WriteString(result.stderr)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// promptsDir is the directory in a sandbox that stores the prompt templates
+const promptsDir = "prompts"
+
+// frontMatterDelimiter separates the front matter from the prompt template
+const frontMatterDelimiter = "---"
+
+// promptArgument is an argument declared in the front matter of a prompt template
+type promptArgument struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// promptFrontMatter is the front matter of a prompt template
+type promptFrontMatter struct {
+	Description string           `yaml:"description"`
+	Arguments   []promptArgument `yaml:"arguments"`
+}
+
+// SandboxPrompt is a prompt of a sandbox with the handler that renders it
+type SandboxPrompt struct {
+	Prompt  mcp.Prompt
+	Handler func(context.Context, mcp.GetPromptRequest) (*mcp.GetPromptResult, error)
+}
+
+// NewSandboxPrompts creates prompts from the prompts/*.md templates in a sandbox directory
+// The prompts are named after the sandbox and the file, like python_debug_traceback
+func NewSandboxPrompts(sandboxConfig *config.SandboxConfig) ([]SandboxPrompt, error) {
+	paths, err := filepath.Glob(filepath.Join(sandboxConfig.Dir, promptsDir, "*.md"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find prompts: %v", err)
+	}
+
+	prompts := make([]SandboxPrompt, 0, len(paths))
+	for _, path := range paths {
+		prompt, err := newSandboxPrompt(sandboxConfig, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load prompt %s: %v", path, err)
+		}
+		prompts = append(prompts, prompt)
+	}
+
+	return prompts, nil
+}
+
+// newSandboxPrompt creates a prompt from a template file
+func newSandboxPrompt(sandboxConfig *config.SandboxConfig, path string) (SandboxPrompt, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SandboxPrompt{}, err
+	}
+
+	frontMatter, body, err := parseFrontMatter(string(data))
+	if err != nil {
+		return SandboxPrompt{}, err
+	}
+
+	// Fail early on invalid templates instead of when the prompt is requested
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return SandboxPrompt{}, fmt.Errorf("invalid template: %v", err)
+	}
+
+	name := fmt.Sprintf("%s_%s", sandboxConfig.Id, strings.TrimSuffix(filepath.Base(path), ".md"))
+	description := frontMatter.Description
+	if description == "" {
+		description = fmt.Sprintf("Prompt for the %s sandbox", sandboxConfig.Name())
+	}
+
+	options := []mcp.PromptOption{mcp.WithPromptDescription(description)}
+	for _, argument := range frontMatter.Arguments {
+		argumentOptions := []mcp.ArgumentOption{mcp.ArgumentDescription(argument.Description)}
+		if argument.Required {
+			argumentOptions = append(argumentOptions, mcp.RequiredArgument())
+		}
+		options = append(options, mcp.WithArgument(argument.Name, argumentOptions...))
+	}
+
+	return SandboxPrompt{
+		Prompt: mcp.NewPrompt(name, options...),
+		Handler: func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			// Check that all required arguments are provided
+			for _, argument := range frontMatter.Arguments {
+				if argument.Required && request.Params.Arguments[argument.Name] == "" {
+					return nil, fmt.Errorf("%s argument is required", argument.Name)
+				}
+			}
+
+			var text bytes.Buffer
+			if err := tmpl.Execute(&text, request.Params.Arguments); err != nil {
+				return nil, fmt.Errorf("failed to render prompt: %v", err)
+			}
+
+			return mcp.NewGetPromptResult(description, []mcp.PromptMessage{
+				mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(strings.TrimSpace(text.String()))),
+			}), nil
+		},
+	}, nil
+}
+
+// parseFrontMatter splits a template into its YAML front matter and body
+// Templates without a front matter, or with an empty one, have no description and arguments
+func parseFrontMatter(data string) (*promptFrontMatter, string, error) {
+	frontMatter := &promptFrontMatter{}
+
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	if !strings.HasPrefix(data, frontMatterDelimiter+"\n") {
+		return frontMatter, data, nil
+	}
+
+	// The closing delimiter is a line of its own, which directly follows
+	// the opening one if the front matter is empty
+	rest := strings.TrimPrefix(data, frontMatterDelimiter+"\n")
+	offset := 0
+	for {
+		line, _, found := strings.Cut(rest[offset:], "\n")
+		if strings.TrimRight(line, " \t") == frontMatterDelimiter {
+			break
+		}
+		if !found {
+			return nil, "", fmt.Errorf("front matter is not closed with %s", frontMatterDelimiter)
+		}
+		offset += len(line) + 1
+	}
+
+	if err := yaml.Unmarshal([]byte(rest[:offset]), frontMatter); err != nil {
+		return nil, "", fmt.Errorf("failed to parse front matter: %v", err)
+	}
+
+	// Skip the closing delimiter line
+	_, body, _ := strings.Cut(rest[offset:], "\n")
+
+	return frontMatter, body, nil
+}
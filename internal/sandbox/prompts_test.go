@@ -0,0 +1,132 @@
+package sandbox_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// newPrompt loads the prompt template of the shell sandbox
+func newPrompt(t *testing.T, template string) (sandbox.SandboxPrompt, error) {
+	t.Helper()
+	sandboxConfig := newConfig()
+	sandboxConfig.Dir = t.TempDir()
+	dir := filepath.Join(sandboxConfig.Dir, "prompts")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "explain.md"), []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prompts, err := sandbox.NewSandboxPrompts(sandboxConfig)
+	if err != nil {
+		return sandbox.SandboxPrompt{}, err
+	}
+	if len(prompts) != 1 {
+		t.Fatalf("expected one prompt, got %d", len(prompts))
+	}
+	return prompts[0], nil
+}
+
+// getPrompt renders a prompt with the given arguments
+func getPrompt(prompt sandbox.SandboxPrompt, arguments map[string]string) (string, error) {
+	request := mcp.GetPromptRequest{}
+	request.Params.Name = prompt.Prompt.Name
+	request.Params.Arguments = arguments
+	result, err := prompt.Handler(context.Background(), request)
+	if err != nil {
+		return "", err
+	}
+	return result.Messages[0].Content.(mcp.TextContent).Text, nil
+}
+
+func TestSandboxPrompts(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		arguments   map[string]string
+		description string
+		text        string
+	}{
+		{
+			name:        "arguments",
+			template:    "---\ndescription: Explain a script\narguments:\n  - name: script\n    required: true\n  - name: level\n---\nExplain {{.script}} for a {{.level}} reader.\n",
+			arguments:   map[string]string{"script": "main.sh", "level": "beginner"},
+			description: "Explain a script",
+			text:        "Explain main.sh for a beginner reader.",
+		},
+		{
+			name:        "missing optional argument",
+			template:    "---\narguments:\n  - name: script\n  - name: level\n---\nExplain {{.script}}{{with .level}} for a {{.}} reader{{end}}.\n",
+			arguments:   map[string]string{"script": "main.sh"},
+			description: "Prompt for the shell sandbox",
+			text:        "Explain main.sh.",
+		},
+		{
+			name:        "missing front matter",
+			template:    "Explain {{.script}}.\n---\nNot a front matter.\n",
+			arguments:   map[string]string{"script": "main.sh"},
+			description: "Prompt for the shell sandbox",
+			text:        "Explain main.sh.\n---\nNot a front matter.",
+		},
+		{
+			name:        "empty front matter",
+			template:    "---\n---\nExplain {{.script}}.\n",
+			arguments:   map[string]string{"script": "main.sh"},
+			description: "Prompt for the shell sandbox",
+			text:        "Explain main.sh.",
+		},
+		{
+			name:        "windows line endings",
+			template:    "---\r\ndescription: Explain\r\n---\r\nExplain {{.script}}.\r\n",
+			arguments:   map[string]string{"script": "main.sh"},
+			description: "Explain",
+			text:        "Explain main.sh.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, err := newPrompt(t, tt.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if prompt.Prompt.Name != "shell_explain" || prompt.Prompt.Description != tt.description {
+				t.Errorf("unexpected prompt %q with description %q", prompt.Prompt.Name, prompt.Prompt.Description)
+			}
+
+			text, err := getPrompt(prompt, tt.arguments)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if text != tt.text {
+				t.Errorf("expected %q, got %q", tt.text, text)
+			}
+		})
+	}
+}
+
+func TestSandboxPromptErrors(t *testing.T) {
+	if _, err := newPrompt(t, "---\ndescription: Explain\nExplain it.\n"); err == nil || !strings.Contains(err.Error(), "not closed") {
+		t.Errorf("expected an error for an unclosed front matter, got %v", err)
+	}
+	if _, err := newPrompt(t, "Explain {{.script"); err == nil || !strings.Contains(err.Error(), "invalid template") {
+		t.Errorf("expected an error for an invalid template, got %v", err)
+	}
+
+	prompt, err := newPrompt(t, "---\narguments:\n  - name: script\n    required: true\n---\nExplain {{.script}}.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompt.Prompt.Arguments) != 1 || !prompt.Prompt.Arguments[0].Required {
+		t.Errorf("expected a required argument, got %+v", prompt.Prompt.Arguments)
+	}
+	if _, err := getPrompt(prompt, nil); err == nil || !strings.Contains(err.Error(), "script argument is required") {
+		t.Errorf("expected an error for a missing required argument, got %v", err)
+	}
+}
@@ -1,129 +1,286 @@
 package sandbox
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"aead.dev/minisign"
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
 	"github.com/pottekkat/sandbox-mcp/internal/version"
 )
 
 const (
-	githubReleaseURL = "https://github.com/pottekkat/sandbox-mcp/releases/download/%s/sandboxes.tar.gz"
+	githubReleaseURL = "https://github.com/pottekkat/sandbox-mcp/releases/download/%s/"
+	// sandboxesArchive is the name of the released sandboxes archive
+	sandboxesArchive = "sandboxes.tar.gz"
+	// checksumsFile lists the SHA-256 checksums of the released archives
+	checksumsFile = "sandboxes.sha256"
+	// signatureFile is the minisign signature of the checksums file
+	signatureFile = checksumsFile + ".minisig"
+	// maxMetadataSize limits the size of the checksums and signature files
+	maxMetadataSize = 1 << 20
 )
 
-// PullSandboxes downloads and extracts sandboxes from GitHub releases
-func PullSandboxes(destPath string, force bool) error {
-	// Build the download URL using the current version
-	url := fmt.Sprintf(githubReleaseURL, version.GetVersion())
-	log.Printf("Downloading sandboxes from: %s", url)
+// publicKeyFile is the minisign public key that signs the released checksums
+// It is committed by the maintainers, builds without it cannot verify releases
+const publicKeyFile = "keys/sandboxes.pub"
 
-	// Download the file
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download sandboxes: %v", err)
-	}
-	defer resp.Body.Close()
+// keys holds the public key of the releases, if there is one
+//
+//go:embed keys
+var keys embed.FS
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download sandboxes: HTTP %d", resp.StatusCode)
+// PullOptions configures which sandboxes are installed from a source
+type PullOptions struct {
+	// Force overwrites existing sandboxes
+	Force bool
+	// Sandboxes limits the installed sandboxes to these ids, all if empty
+	Sandboxes []string
+	// NoDefaults leaves the defaults files of the sandboxes directory alone
+	NoDefaults bool
+	// Insecure installs releases without verifying their checksums,
+	// for releases made before the checksums were signed or builds without a public key
+	Insecure bool
+}
+
+// selected returns true if the sandbox should be installed
+func (o PullOptions) selected(id string) bool {
+	return len(o.Sandboxes) == 0 || slices.Contains(o.Sandboxes, id)
+}
+
+// pullRelease downloads and extracts sandboxes from GitHub releases and returns the installed sandboxes
+// The archive is only extracted if its checksum matches the signed checksums file, unless opts.Insecure is set
+func pullRelease(destPath string, opts PullOptions) ([]string, error) {
+	// Build the download URLs using the current version
+	baseURL := fmt.Sprintf(githubReleaseURL, version.GetVersion())
+
+	var publicKey, checksums, signature []byte
+	if opts.Insecure {
+		slog.Warn("Installing sandboxes without verifying their checksums", "url", baseURL+sandboxesArchive)
+	} else {
+		var err error
+		publicKey, err = fs.ReadFile(keys, publicKeyFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("this build has no public key to verify releases, pull with --insecure or --from instead")
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read the public key: %v", err)
+		}
+
+		// Download the signed checksums first to fail early if they are missing
+		checksums, err = downloadBytes(baseURL + checksumsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download checksums, releases before signed checksums can only be pulled with --insecure: %v", err)
+		}
+		signature, err = downloadBytes(baseURL + signatureFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download checksums signature: %v", err)
+		}
 	}
+	slog.Info("Downloading sandboxes", "url", baseURL+sandboxesArchive)
 
 	// Create a temporary file to store the download
 	tmpFile, err := os.CreateTemp("", "sandboxes-*")
 	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %v", err)
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
 	}
 	defer os.Remove(tmpFile.Name())
 	defer tmpFile.Close()
 
-	// Copy the download to the temporary file
-	_, err = io.Copy(tmpFile, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to save download: %v", err)
+	// Hash the archive while saving it to the temporary file
+	hash := sha256.New()
+	if err := download(baseURL+sandboxesArchive, io.MultiWriter(tmpFile, hash)); err != nil {
+		return nil, fmt.Errorf("failed to download sandboxes: %v", err)
 	}
 
-	// Extract the tar.gz file
-	if err := extractTarGz(tmpFile.Name(), destPath, force); err != nil {
-		return fmt.Errorf("failed to extract sandboxes: %v", err)
+	// Refuse to install anything that was not released
+	if !opts.Insecure {
+		if err := verifyChecksum(publicKey, checksums, signature, sandboxesArchive, hash.Sum(nil)); err != nil {
+			return nil, fmt.Errorf("refusing to install sandboxes: %v", err)
+		}
+		slog.Info("Verified the checksum and signature", "file", sandboxesArchive)
 	}
 
-	log.Printf("Successfully downloaded and extracted sandboxes to: %s", destPath)
-	return nil
+	// Extract the tar.gz file
+	ids, err := extractTarGz(tmpFile.Name(), destPath, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract sandboxes: %v", err)
+	}
+	return ids, nil
 }
 
-// extractTarGz unpacks a tar.gz archive to the specified path
-func extractTarGz(srcPath, destPath string, force bool) error {
-	file, err := os.Open(srcPath)
+// PullSource installs sandboxes from a release, an archive URL, a local archive or a local directory
+// The sandboxes selected in opts take precedence over the sandboxes selected by the source
+// The installed sandboxes are recorded in the lockfile, so that they can be updated later
+func PullSource(destPath string, source appconfig.Source, opts PullOptions) error {
+	ids, err := fetchSource(destPath, source, opts)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	// Set up gzip reader
-	gzr, err := gzip.NewReader(file)
+	lock, err := LoadLockfile(destPath)
 	if err != nil {
 		return err
 	}
-	defer gzr.Close()
+	for _, id := range ids {
+		if err := lock.Record(destPath, id, source.URL, filepath.Join(destPath, id)); err != nil {
+			return err
+		}
+	}
+	if err := lock.Save(destPath); err != nil {
+		return err
+	}
 
-	// Read tar archive
-	tr := tar.NewReader(gzr)
+	slog.Info("Installed sandboxes", "count", len(ids), "source", source.Describe(), "path", destPath)
+	return nil
+}
 
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
+// fetchSource installs the sandboxes of a source into destPath and returns the installed sandboxes
+func fetchSource(destPath string, source appconfig.Source, opts PullOptions) ([]string, error) {
+	if len(opts.Sandboxes) == 0 {
+		opts.Sandboxes = source.Sandboxes
+	}
+
+	location := strings.TrimPrefix(source.URL, "file://")
+	switch {
+	case source.URL == "" || source.URL == appconfig.SourceRelease:
+		return pullRelease(destPath, opts)
+	case strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://"):
+		slog.Info("Downloading sandboxes", "url", location)
+
+		tmpFile, err := os.CreateTemp("", "sandboxes-*")
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to create temporary file: %v", err)
 		}
+		defer os.Remove(tmpFile.Name())
+		defer tmpFile.Close()
 
-		// Only process files in the sandboxes directory
-		if !strings.HasPrefix(header.Name, "sandboxes/") {
-			continue
+		if err := download(location, tmpFile); err != nil {
+			return nil, fmt.Errorf("failed to download sandboxes: %v", err)
 		}
+		location = tmpFile.Name()
+	}
 
-		// Get path relative to sandboxes directory
-		relPath := strings.TrimPrefix(header.Name, "sandboxes/")
-		if relPath == "" {
-			continue
-		}
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %v", err)
+	}
 
-		targetPath := filepath.Join(destPath, relPath)
+	if info.IsDir() {
+		ids, err := copySandboxes(location, destPath, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy sandboxes: %v", err)
+		}
+		return ids, nil
+	}
 
-		// Skip existing sandboxes unless force is true
-		if !force && header.Typeflag == tar.TypeDir {
-			if _, err := os.Stat(targetPath); err == nil {
-				log.Printf("Skipping existing sandbox: %s", relPath)
-				continue
-			}
+	if source.SHA256 != "" {
+		if err := verifyFileChecksum(location, source.SHA256); err != nil {
+			return nil, fmt.Errorf("refusing to install sandboxes: %v", err)
 		}
+	}
+	ids, err := extractTarGz(location, destPath, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract sandboxes: %v", err)
+	}
+	return ids, nil
+}
+
+// download writes the body of a successful GET request to w
+func download(url string, w io.Writer) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// downloadBytes downloads a small file into memory
+func downloadBytes(url string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := download(url, &limitedWriter{w: &buf, n: maxMetadataSize}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// limitedWriter fails once more than n bytes are written
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p if the limit is not exceeded
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, fmt.Errorf("file is larger than %d bytes", maxMetadataSize)
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
 
-		// Handle directories and files
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(targetPath, 0755); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			outFile, err := os.Create(targetPath)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(outFile, tr); err != nil {
-				outFile.Close()
-				return err
-			}
-			outFile.Close()
+// verifyChecksum checks the signature of the checksums file with the minisign public key
+// and that it lists the given SHA-256 sum for the file name
+func verifyChecksum(publicKeyText []byte, checksums []byte, signature []byte, name string, sum []byte) error {
+	var publicKey minisign.PublicKey
+	if err := publicKey.UnmarshalText(bytes.TrimSpace(publicKeyText)); err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	if !minisign.Verify(publicKey, checksums, signature) {
+		return fmt.Errorf("invalid signature of %s", checksumsFile)
+	}
+
+	// Each line has the format of sha256sum: "<hex sum>  <file name>"
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		expected, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid checksum of %s: %v", name, err)
+		}
+		if !bytes.Equal(expected, sum) {
+			return fmt.Errorf("checksum mismatch for %s: expected %x, got %x", name, expected, sum)
 		}
+		return nil
 	}
 
+	return fmt.Errorf("no checksum for %s in %s", name, checksumsFile)
+}
+
+// verifyFileChecksum checks that a file has the expected hex-encoded SHA-256 sum
+func verifyFileChecksum(path string, expected string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, expected) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, sum)
+	}
 	return nil
 }
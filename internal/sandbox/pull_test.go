@@ -0,0 +1,407 @@
+package sandbox_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aead.dev/minisign"
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// entry is a file, directory or symlink in a test archive
+type entry struct {
+	name     string
+	content  string
+	mode     int64
+	typeflag byte
+	linkname string
+}
+
+// writeArchive creates a tar.gz archive with the entries and returns its path
+func writeArchive(t *testing.T, entries []entry) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sandboxes.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.name,
+			Mode:     e.mode,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Size:     int64(len(e.content)),
+		}
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		}
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		if header.Typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// pull installs the sandboxes of an archive into a new sandboxes directory
+func pull(t *testing.T, destPath string, archive string, opts sandbox.PullOptions) error {
+	t.Helper()
+	return sandbox.PullSource(destPath, appconfig.Source{URL: archive}, opts)
+}
+
+func TestPullPreservesModes(t *testing.T) {
+	dest := t.TempDir()
+	archive := writeArchive(t, []entry{
+		{name: "sandboxes/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "sandboxes/shell/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "sandboxes/shell/config.json", content: "{}"},
+		{name: "sandboxes/shell/entrypoint.sh", content: "#!/bin/sh", mode: 0755},
+		{name: "sandboxes/shell/current", typeflag: tar.TypeSymlink, linkname: "entrypoint.sh"},
+	})
+
+	if err := pull(t, dest, archive, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "shell", "entrypoint.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755, got %o", info.Mode().Perm())
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "shell", "current")); err != nil || target != "entrypoint.sh" {
+		t.Errorf("expected symlink to entrypoint.sh, got %q (%v)", target, err)
+	}
+}
+
+func TestPullRejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{"parent directory", []entry{{name: "sandboxes/../../escape.txt", content: "owned"}}},
+		{"absolute path", []entry{{name: "/tmp/escape.txt", content: "owned"}}},
+		{"absolute symlink", []entry{{name: "sandboxes/shell/passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}}},
+		{"symlink to another sandbox", []entry{{name: "sandboxes/shell/other", typeflag: tar.TypeSymlink, linkname: "../python"}}},
+		{"symlink through another symlink", []entry{
+			{name: "sandboxes/shell/a/b/", typeflag: tar.TypeDir},
+			{name: "sandboxes/shell/a/b/l2", typeflag: tar.TypeSymlink, linkname: "../.."},
+			{name: "sandboxes/shell/x", typeflag: tar.TypeSymlink, linkname: "a/b/l2/../../../etc/passwd"},
+		}},
+		{"symlink loop", []entry{
+			{name: "sandboxes/shell/loop1", typeflag: tar.TypeSymlink, linkname: "loop2"},
+			{name: "sandboxes/shell/loop2", typeflag: tar.TypeSymlink, linkname: "loop1"},
+		}},
+		{"chained symlinks", []entry{
+			{name: "sandboxes/python/a", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "sandboxes/python/a/a/a/b/", typeflag: tar.TypeDir},
+			{name: "sandboxes/python/a/a/a/b/x", typeflag: tar.TypeSymlink, linkname: "../../../.."},
+			{name: "sandboxes/python/a/a/a/b/x/pwned", content: "owned"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "sandboxes")
+			archive := writeArchive(t, append([]entry{
+				{name: "sandboxes/shell/config.json", content: "{}"},
+			}, tt.entries...))
+
+			err := pull(t, dest, archive, sandbox.PullOptions{})
+			if err == nil || !strings.Contains(err.Error(), "illegal") {
+				t.Fatalf("expected an illegal path error, got %v", err)
+			}
+
+			// Nothing is installed from a rejected archive
+			if _, err := os.Stat(filepath.Join(dest, "shell")); !os.IsNotExist(err) {
+				t.Errorf("expected no partial sandbox, got %v", err)
+			}
+			entries, _ := os.ReadDir(parent)
+			if len(entries) != 1 {
+				t.Errorf("expected only the sandboxes directory, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestPullForceReplacesSandbox(t *testing.T) {
+	dest := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dest, "shell"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "shell", "stale.sh"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := writeArchive(t, []entry{
+		{name: "sandboxes/shell/config.json", content: "new"},
+		{name: "sandboxes/python/config.json", content: "{}"},
+	})
+
+	// Existing sandboxes are kept without force
+	if err := pull(t, dest, archive, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "shell", "stale.sh")); err != nil {
+		t.Errorf("expected existing sandbox to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "python", "config.json")); err != nil {
+		t.Errorf("expected new sandbox to be installed: %v", err)
+	}
+
+	// Existing sandboxes are replaced as a whole with force
+	if err := pull(t, dest, archive, sandbox.PullOptions{Force: true, Sandboxes: []string{"shell"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "shell", "stale.sh")); !os.IsNotExist(err) {
+		t.Errorf("expected stale file to be removed, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "shell", "config.json")); string(data) != "new" {
+		t.Errorf("expected new config, got %q", data)
+	}
+}
+
+func TestPullSource(t *testing.T) {
+	archive := writeArchive(t, []entry{
+		{name: "sandboxes/shell/config.json", content: `{"id": "shell"}`},
+		{name: "sandboxes/python/config.json", content: `{"id": "python"}`},
+	})
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// A checkout with the sandboxes next to other files of the repository
+	checkout := t.TempDir()
+	for name, content := range map[string]string{
+		"README.md":                    "# Sandboxes",
+		".git/HEAD":                    "ref: refs/heads/main",
+		"sandboxes/shell/config.json":  `{"id": "shell"}`,
+		"sandboxes/python/config.json": `{"id": "python"}`,
+	} {
+		path := filepath.Join(checkout, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sandboxes.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		source appconfig.Source
+		opts   sandbox.PullOptions
+		ids    []string
+		err    string
+	}{
+		{"local directory", appconfig.Source{URL: checkout}, sandbox.PullOptions{}, []string{"python", "shell"}, ""},
+		{"file URL of a directory", appconfig.Source{URL: "file://" + checkout}, sandbox.PullOptions{}, []string{"python", "shell"}, ""},
+		{"local archive", appconfig.Source{URL: archive}, sandbox.PullOptions{}, []string{"python", "shell"}, ""},
+		{"archive URL", appconfig.Source{URL: server.URL + "/sandboxes.tar.gz"}, sandbox.PullOptions{}, []string{"python", "shell"}, ""},
+		{"sandboxes of the source", appconfig.Source{URL: checkout, Sandboxes: []string{"shell"}}, sandbox.PullOptions{}, []string{"shell"}, ""},
+		{"sandboxes of the options", appconfig.Source{URL: archive, Sandboxes: []string{"shell"}}, sandbox.PullOptions{Sandboxes: []string{"python"}}, []string{"python"}, ""},
+		{"matching checksum", appconfig.Source{URL: archive, SHA256: sum}, sandbox.PullOptions{}, []string{"python", "shell"}, ""},
+		{"matching checksum of a download", appconfig.Source{URL: server.URL + "/sandboxes.tar.gz", SHA256: strings.ToUpper(sum)}, sandbox.PullOptions{}, []string{"python", "shell"}, ""},
+		{"checksum mismatch", appconfig.Source{URL: archive, SHA256: strings.Repeat("0", 64)}, sandbox.PullOptions{}, nil, "checksum mismatch"},
+		{"checksum mismatch of a download", appconfig.Source{URL: server.URL + "/sandboxes.tar.gz", SHA256: strings.Repeat("0", 64)}, sandbox.PullOptions{}, nil, "checksum mismatch"},
+		{"missing archive URL", appconfig.Source{URL: server.URL + "/missing.tar.gz"}, sandbox.PullOptions{}, nil, "failed to download sandboxes"},
+		{"missing path", appconfig.Source{URL: filepath.Join(checkout, "missing")}, sandbox.PullOptions{}, nil, "failed to read source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "sandboxes")
+			err := sandbox.PullSource(dest, tt.source, tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error with %q, got %v", tt.err, err)
+				}
+				// Nothing is installed from a rejected source
+				if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+					t.Errorf("expected no installed sandboxes, got %d entries", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Only the sandbox directories are installed and recorded with their source
+			var ids []string
+			entries, err := os.ReadDir(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if !strings.HasPrefix(entry.Name(), ".") {
+					ids = append(ids, entry.Name())
+				}
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.ids, ",") {
+				t.Errorf("expected sandboxes %v, got %v", tt.ids, ids)
+			}
+
+			lock, err := sandbox.LoadLockfile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range tt.ids {
+				if entry, ok := lock.Sandboxes[id]; !ok || entry.Source != tt.source.URL {
+					t.Errorf("expected %s to be recorded with source %s, got %+v", id, tt.source.URL, entry)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	publicKey, privateKey, err := minisign.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyText, err := publicKey.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("sandboxes"))
+	other := sha256.Sum256([]byte("other"))
+	checksums := []byte(fmt.Sprintf("%x  sandboxes.tar.gz\n%x  sandboxes.zip\n", sum, other))
+	binaryChecksums := []byte(fmt.Sprintf("%x *sandboxes.tar.gz\n", sum))
+	mismatchChecksums := []byte(fmt.Sprintf("%x  sandboxes.tar.gz\n", other))
+	missingChecksums := []byte(fmt.Sprintf("%x  sandboxes.zip\n", other))
+
+	tests := []struct {
+		name      string
+		checksums []byte
+		signed    []byte
+		err       string
+	}{
+		{"valid signature", checksums, checksums, ""},
+		{"binary mode entry", binaryChecksums, binaryChecksums, ""},
+		{"tampered checksums", mismatchChecksums, checksums, "invalid signature"},
+		{"checksum mismatch", mismatchChecksums, mismatchChecksums, "checksum mismatch"},
+		{"missing entry", missingChecksums, missingChecksums, "no checksum for sandboxes.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature := minisign.Sign(privateKey, tt.signed)
+			err := sandbox.VerifyChecksum(publicKeyText, tt.checksums, signature, "sandboxes.tar.gz", sum[:])
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected an error with %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// Checksums signed with another key are rejected
+	_, otherKey, err := minisign.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sandbox.VerifyChecksum(publicKeyText, checksums, minisign.Sign(otherKey, checksums), "sandboxes.tar.gz", sum[:])
+	if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("expected an invalid signature error, got %v", err)
+	}
+}
+
+func TestPullInstallsDefaults(t *testing.T) {
+	dest := t.TempDir()
+	archive := writeArchive(t, []entry{
+		{name: "sandboxes/defaults.json", content: `{"user": "sandbox"}`},
+		{name: "sandboxes/README.md", content: "# Sandboxes"},
+		{name: "sandboxes/shell/config.json", content: "{}"},
+		{name: "sandboxes/python/config.json", content: "{}"},
+	})
+
+	// The defaults file is shared, so it is installed with any selected sandbox
+	if err := pull(t, dest, archive, sandbox.PullOptions{Sandboxes: []string{"shell"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "defaults.json")); string(data) != `{"user": "sandbox"}` {
+		t.Errorf("expected the defaults file to be installed, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "README.md")); !os.IsNotExist(err) {
+		t.Errorf("expected other files next to the sandboxes to be skipped, got %v", err)
+	}
+
+	// An existing defaults file is kept without force, even in another format
+	if err := os.Remove(filepath.Join(dest, "defaults.json")); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dest, map[string]string{"defaults.yaml": "user: me\n"})
+	if err := pull(t, dest, archive, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "defaults.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the defaults file not to be installed next to the existing one, got %v", err)
+	}
+
+	// With force, it replaces the existing defaults file
+	if err := pull(t, dest, archive, sandbox.PullOptions{Force: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "defaults.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected the old defaults file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "defaults.json")); err != nil {
+		t.Errorf("expected the defaults file to be installed: %v", err)
+	}
+}
+
+func TestPullReleaseWithoutPublicKey(t *testing.T) {
+	if _, err := os.Stat(filepath.Join("keys", "sandboxes.pub")); err == nil {
+		t.Skip("this build has a public key")
+	}
+
+	err := sandbox.PullSource(t.TempDir(), appconfig.Source{URL: appconfig.SourceRelease}, sandbox.PullOptions{})
+	if err == nil || !strings.Contains(err.Error(), "--insecure") {
+		t.Errorf("expected an error about the missing public key, got %v", err)
+	}
+}
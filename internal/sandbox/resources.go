@@ -0,0 +1,240 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// SandboxResource is a resource of a sandbox with the handler that reads it
+type SandboxResource struct {
+	Resource mcp.Resource
+	Handler  func(context.Context, mcp.ReadResourceRequest) ([]mcp.ResourceContents, error)
+}
+
+// NewSandboxResources creates resources for the config and the files in a sandbox directory
+// like sandbox://python/config, sandbox://python/Dockerfile and sandbox://python/requirements.txt
+// The config resource is the config the sandbox runs with, the config file is a resource of its own
+func NewSandboxResources(sandboxConfig *config.SandboxConfig) ([]SandboxResource, error) {
+	entries, err := os.ReadDir(sandboxConfig.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sandbox directory: %v", err)
+	}
+
+	configResource, err := newConfigResource(sandboxConfig)
+	if err != nil {
+		return nil, err
+	}
+	resources := []SandboxResource{configResource}
+
+	for _, entry := range entries {
+		// Only expose the top-level files of the sandbox
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		resources = append(resources, newFileResource(
+			fmt.Sprintf("sandbox://%s/%s", sandboxConfig.Id, entry.Name()),
+			filepath.Join(sandboxConfig.Dir, entry.Name()),
+			fmt.Sprintf("The %s file of the %s sandbox", entry.Name(), sandboxConfig.Name()),
+		))
+	}
+
+	return resources, nil
+}
+
+// newConfigResource creates a resource with the effective config of a sandbox as JSON,
+// with the values inherited from extends and the defaults, the overrides and the limits applied
+func newConfigResource(sandboxConfig *config.SandboxConfig) (SandboxResource, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(sandboxConfig); err != nil {
+		return SandboxResource{}, fmt.Errorf("failed to encode the config of sandbox %s: %v", sandboxConfig.Id, err)
+	}
+	text := buf.String()
+
+	return SandboxResource{
+		Resource: mcp.NewResource(fmt.Sprintf("sandbox://%s/config", sandboxConfig.Id), "config",
+			mcp.WithResourceDescription(fmt.Sprintf("Effective configuration of the %s sandbox, as it runs", sandboxConfig.Name())),
+			mcp.WithMIMEType("application/json"),
+		),
+		Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "application/json",
+					Text:     text,
+				},
+			}, nil
+		},
+	}, nil
+}
+
+// newFileResource creates a resource that reads a file every time it is requested
+func newFileResource(uri string, path string, description string) SandboxResource {
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "text/plain"
+	}
+
+	return SandboxResource{
+		Resource: mcp.NewResource(uri, filepath.Base(path),
+			mcp.WithResourceDescription(description),
+			mcp.WithMIMEType(mimeType),
+		),
+		Handler: func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", path, err)
+			}
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: mimeType,
+					Text:     string(data),
+				},
+			}, nil
+		},
+	}
+}
+
+// NewPackagesResourceTemplate creates a resource template for the packages installed in a sandbox
+func NewPackagesResourceTemplate() mcp.ResourceTemplate {
+	return mcp.NewResourceTemplate("sandbox://{id}/packages", "packages",
+		mcp.WithTemplateDescription("Packages installed in a sandbox, as reported by the inventory command of the sandbox"),
+		mcp.WithTemplateMIMEType("text/plain"),
+	)
+}
+
+// NewPackagesResourceHandler creates a handler function for the packages resource template
+// The inventory command is run once per image and the output is cached
+// Sandboxes with a matrix list the packages of each variant
+func NewPackagesResourceHandler(configs map[string]*config.SandboxConfig, opts ...HandlerOption) func(context.Context, mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	options := newHandlerOptions(opts)
+	var mu sync.Mutex
+	// cache holds the output of the inventory commands by image and command,
+	// as sandboxes and variants can share an image
+	cache := make(map[string]string)
+
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		id := templateArgument(request, "id")
+		sandboxConfig, ok := configs[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown sandbox %q", id)
+		}
+		if len(sandboxConfig.Inventory) == 0 {
+			return nil, fmt.Errorf("sandbox %s does not have an inventory command", id)
+		}
+
+		variants := sandboxConfig.Matrix
+		if !sandboxConfig.HasMatrix() {
+			variants = []config.SandboxVariant{{Image: sandboxConfig.Image}}
+		}
+
+		// Running the inventory command is slow, so only one runs at a time
+		mu.Lock()
+		defer mu.Unlock()
+
+		contents := make([]mcp.ResourceContents, 0, len(variants))
+		for _, variant := range variants {
+			key := variant.Image + "\x00" + strings.Join(sandboxConfig.Inventory, "\x00")
+			packages, ok := cache[key]
+			if !ok {
+				var err error
+				packages, err = runInventory(ctx, sandboxConfig, variant.Image, options)
+				if err != nil {
+					return nil, err
+				}
+				cache[key] = packages
+			}
+
+			if variant.Label != "" {
+				packages = fmt.Sprintf("Variant `%s` (`%s`):\n%s", variant.Label, variant.Image, packages)
+			}
+			contents = append(contents, mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "text/plain",
+				Text:     packages,
+			})
+		}
+		return contents, nil
+	}
+}
+
+// templateArgument returns a variable of the URI template of a resource
+// The server matches the variables as lists of values
+func templateArgument(request mcp.ReadResourceRequest, name string) string {
+	switch value := request.Params.Arguments[name].(type) {
+	case string:
+		return value
+	case []string:
+		if len(value) > 0 {
+			return value[0]
+		}
+	}
+	return ""
+}
+
+// runInventory runs the inventory command of a sandbox in an image and returns the output
+func runInventory(ctx context.Context, sandboxConfig *config.SandboxConfig, image string, options *handlerOptions) (string, error) {
+	// Wait until the sandbox is allowed to run
+	release, err := acquire(ctx)
+	if err != nil {
+		return "", fmt.Errorf("cancelled while waiting to run the sandbox: %v", err)
+	}
+	defer release()
+
+	// Connect to Docker
+	cli, closeRuntime, err := options.openRuntime()
+	if err != nil {
+		return "", err
+	}
+	defer closeRuntime()
+
+	inventoryCtx, cancel := context.WithTimeout(ctx, sandboxConfig.Timeout())
+	defer cancel()
+
+	containerConfig := &container.Config{
+		Image: image,
+		Cmd:   sandboxConfig.Inventory,
+		User:  sandboxConfig.User,
+	}
+
+	// The inventory command only needs the image, not the network or the mount
+	hostConfig := newHostConfig(sandboxConfig, "", "none", true)
+	hostConfig.Mounts = nil
+
+	resp, err := cli.ContainerCreate(inventoryCtx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create inventory container: %v", err)
+	}
+	defer removeContainer(cli, resp.ID, sandboxConfig.Timeout())
+
+	if err := cli.ContainerStart(inventoryCtx, resp.ID, container.StartOptions{}); err != nil {
+		return "", fmt.Errorf("failed to start inventory container: %v", err)
+	}
+
+	stdout, stderr, exitCode, err := waitForExit(inventoryCtx, cli, resp.ID)
+	if err != nil {
+		if inventoryCtx.Err() != nil {
+			return "", fmt.Errorf("inventory timeout after %d seconds", int(sandboxConfig.Timeout().Seconds()))
+		}
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("inventory command failed with exit code %d: %s", exitCode, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
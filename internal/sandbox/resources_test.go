@@ -0,0 +1,194 @@
+package sandbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox/sandboxtest"
+)
+
+func TestSandboxResources(t *testing.T) {
+	sandboxConfig := newConfig()
+	sandboxConfig.Dir = t.TempDir()
+	sandboxConfig.ConfigFile = filepath.Join(sandboxConfig.Dir, "config.json")
+	files := map[string]string{
+		"config.json":      `{"id": "shell"}`,
+		"Dockerfile":       "FROM alpine\n",
+		"requirements.txt": "requests\n",
+		".dockerignore":    "*\n",
+		"tests/cases.yaml": "cases: []\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(sandboxConfig.Dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resources, err := sandbox.NewSandboxResources(sandboxConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The effective config, as the sandbox runs with it
+	effective, err := json.MarshalIndent(sandboxConfig, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the config and the visible top-level files are resources
+	expected := map[string]string{
+		"sandbox://shell/config":           string(effective) + "\n",
+		"sandbox://shell/config.json":      files["config.json"],
+		"sandbox://shell/Dockerfile":       files["Dockerfile"],
+		"sandbox://shell/requirements.txt": files["requirements.txt"],
+	}
+	var uris []string
+	for _, resource := range resources {
+		uris = append(uris, resource.Resource.URI)
+
+		request := mcp.ReadResourceRequest{}
+		request.Params.URI = resource.Resource.URI
+		contents, err := resource.Handler(context.Background(), request)
+		if err != nil {
+			t.Fatalf("unexpected error reading %s: %v", resource.Resource.URI, err)
+		}
+		text, ok := contents[0].(mcp.TextResourceContents)
+		if !ok || text.Text != expected[resource.Resource.URI] || text.URI != resource.Resource.URI {
+			t.Errorf("unexpected contents of %s: %+v", resource.Resource.URI, contents)
+		}
+	}
+	slices.Sort(uris)
+	if want := []string{"sandbox://shell/Dockerfile", "sandbox://shell/config", "sandbox://shell/config.json", "sandbox://shell/requirements.txt"}; !slices.Equal(uris, want) {
+		t.Errorf("expected resources %v, got %v", want, uris)
+	}
+	if mimeType := resources[0].Resource.MIMEType; mimeType != "application/json" {
+		t.Errorf("expected the config as JSON, got %s", mimeType)
+	}
+
+	// The files are read every time
+	if err := os.WriteFile(sandboxConfig.ConfigFile, []byte(`{"id": "changed"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, resource := range resources {
+		if resource.Resource.URI != "sandbox://shell/config.json" {
+			continue
+		}
+		request := mcp.ReadResourceRequest{}
+		request.Params.URI = resource.Resource.URI
+		contents, err := resource.Handler(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text := contents[0].(mcp.TextResourceContents).Text; !strings.Contains(text, "changed") {
+			t.Errorf("expected the changed config file, got %q", text)
+		}
+	}
+}
+
+// readPackages reads the packages resource of a sandbox through an MCP server
+func readPackages(t *testing.T, s *server.MCPServer, id string) (*mcp.ReadResourceResult, *mcp.JSONRPCError) {
+	t.Helper()
+	message, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "resources/read",
+		"params":  map[string]any{"uri": "sandbox://" + id + "/packages"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch response := s.HandleMessage(context.Background(), message).(type) {
+	case mcp.JSONRPCResponse:
+		result, ok := response.Result.(mcp.ReadResourceResult)
+		if !ok {
+			t.Fatalf("unexpected result: %+v", response.Result)
+		}
+		return &result, nil
+	case mcp.JSONRPCError:
+		return nil, &response
+	default:
+		t.Fatalf("unexpected response: %+v", response)
+		return nil, nil
+	}
+}
+
+func TestPackagesResource(t *testing.T) {
+	shell := newConfig()
+	shell.Inventory = []string{"apk", "list", "--installed"}
+	python := newConfig()
+	python.Id = "python"
+	python.Image = ""
+	python.Inventory = []string{"pip", "freeze"}
+	python.Matrix = []config.SandboxVariant{
+		{Label: "3.12", Image: "python:3.12"},
+		{Label: "3.13", Image: "python:3.13"},
+	}
+	noInventory := newConfig()
+	noInventory.Id = "no-inventory"
+	configs := map[string]*config.SandboxConfig{shell.Id: shell, python.Id: python, noInventory.Id: noInventory}
+
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script(shell.Inventory, sandboxtest.Script{Stdout: "busybox-1.36\n"})
+	runtime.Script(python.Inventory, sandboxtest.Script{Stdout: "requests==2.32.3\n"})
+
+	s := server.NewMCPServer("test", "1.0.0", server.WithResourceCapabilities(false, false))
+	s.AddResourceTemplate(sandbox.NewPackagesResourceTemplate(), sandbox.NewPackagesResourceHandler(configs, sandbox.WithRuntime(runtime)))
+
+	result, rpcErr := readPackages(t, s, "shell")
+	if rpcErr != nil {
+		t.Fatalf("unexpected error: %+v", rpcErr.Error)
+	}
+	if len(result.Contents) != 1 || result.Contents[0].(mcp.TextResourceContents).Text != "busybox-1.36\n" {
+		t.Errorf("unexpected packages of shell: %+v", result.Contents)
+	}
+
+	// Each variant of a matrix lists the packages of its own image
+	result, rpcErr = readPackages(t, s, "python")
+	if rpcErr != nil {
+		t.Fatalf("unexpected error: %+v", rpcErr.Error)
+	}
+	var texts []string
+	for _, content := range result.Contents {
+		texts = append(texts, content.(mcp.TextResourceContents).Text)
+	}
+	want := []string{
+		"Variant `3.12` (`python:3.12`):\nrequests==2.32.3\n",
+		"Variant `3.13` (`python:3.13`):\nrequests==2.32.3\n",
+	}
+	if !slices.Equal(texts, want) {
+		t.Errorf("expected the packages of each variant, got %q", texts)
+	}
+
+	// The output is cached by image
+	if _, rpcErr := readPackages(t, s, "python"); rpcErr != nil {
+		t.Fatalf("unexpected error: %+v", rpcErr.Error)
+	}
+	var images []string
+	for _, c := range runtime.Containers() {
+		images = append(images, c.Config.Image)
+	}
+	if want := []string{shell.Image, "python:3.12", "python:3.13"}; !slices.Equal(images, want) {
+		t.Errorf("expected one inventory container per image, got %v", images)
+	}
+	assertCleanedUp(t, runtime)
+
+	for id, message := range map[string]string{"ruby": `unknown sandbox "ruby"`, "no-inventory": "does not have an inventory command"} {
+		if _, rpcErr := readPackages(t, s, id); rpcErr == nil || !strings.Contains(rpcErr.Error.Message, message) {
+			t.Errorf("expected an error containing %q for %s, got %+v", message, id, rpcErr)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sandbox
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Runtime is the part of the Docker API used to run sandboxes
+// It is implemented by the Docker client and can be replaced in tests
+type Runtime interface {
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error)
+	ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
+	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+	ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
+	NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error
+	NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error
+	NetworkInspect(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error)
+	NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
+	ImageInspect(ctx context.Context, imageID string, inspectOpts ...client.ImageInspectOption) (image.InspectResponse, error)
+	ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
+	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+}
+
+// HandlerOption configures a sandbox tool handler
+type HandlerOption func(*handlerOptions)
+
+// handlerOptions holds the configuration of a sandbox tool handler
+type handlerOptions struct {
+	runtime     Runtime
+	imagePolicy string
+}
+
+// WithRuntime makes the handler run sandboxes with the given runtime instead of Docker
+func WithRuntime(runtime Runtime) HandlerOption {
+	return func(o *handlerOptions) {
+		o.runtime = runtime
+	}
+}
+
+// WithImagePolicy makes the handler build or pull missing images before running sandboxes
+func WithImagePolicy(policy string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.imagePolicy = policy
+	}
+}
+
+// newHandlerOptions applies the options to the default handler configuration
+func newHandlerOptions(opts []HandlerOption) *handlerOptions {
+	options := &handlerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// openRuntime returns the configured runtime or a new Docker client
+// The returned function closes the Docker client and does nothing for a configured runtime
+func (o *handlerOptions) openRuntime() (Runtime, func(), error) {
+	if o.runtime != nil {
+		return o.runtime, func() {}, nil
+	}
+
+	// Initialize Docker client
+	cli, err := NewDockerClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cli, func() { cli.Close() }, nil
+}
@@ -3,6 +3,8 @@ package sandbox
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,14 +13,15 @@ import (
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/metrics"
 )
 
 // waitForContainer waits for a container to be in running state with a specified timeout
-func waitForContainer(ctx context.Context, cli *client.Client, containerID string, timeout time.Duration) error {
+func waitForContainer(ctx context.Context, cli Runtime, containerID string, timeout time.Duration) error {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -47,9 +50,9 @@ func NewSandboxTool(sandboxConfig *config.SandboxConfig) mcp.Tool {
 	options := []mcp.ToolOption{
 		// All tools have a description and an entrypoint
 		mcp.WithDescription(generateSandboxDescription(sandboxConfig)),
-		withEntrypoint(sandboxConfig.ParamEntrypoint(), fmt.Sprintf("Code to be stored in a file named `%s` and executed with the command `%s`.",
+		withEntrypoint(sandboxConfig.ParamEntrypoint(), fmt.Sprintf("Code to be stored in a file named `%s` and executed %s.",
 			sandboxConfig.Entrypoint,
-			strings.Join(sandboxConfig.Command, " "))),
+			describeCommand(sandboxConfig))),
 
 		mcp.WithTitleAnnotation(sandboxConfig.Name()),
 		mcp.WithReadOnlyHintAnnotation(sandboxConfig.Hints.IsReadOnly(sandboxConfig.Mount.ReadOnly, sandboxConfig.Security.ReadOnly)),
@@ -68,248 +71,488 @@ func NewSandboxTool(sandboxConfig *config.SandboxConfig) mcp.Tool {
 		options = append(options, withAdditionalFiles())
 	}
 
+	// Allow selecting the variants to run on if the sandbox has a matrix
+	if sandboxConfig.HasMatrix() {
+		options = append(options, withVariants(sandboxConfig))
+	}
+
 	// Return a new tool with the tool name and provided options
 	return mcp.NewTool(sandboxConfig.Id, options...)
 }
 
 // NewSandboxToolHandler creates a handler function for a sandbox tool
-func NewSandboxToolHandler(sandboxConfig *config.SandboxConfig) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func NewSandboxToolHandler(sandboxConfig *config.SandboxConfig, opts ...HandlerOption) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	options := newHandlerOptions(opts)
+
 	// Return the handler function that will be run when the tool is called
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// withEntrypoint ToolOption
-		// Get the contents of the entrypoint file from the request
-		entrypointFile := config.SandboxFile{Name: sandboxConfig.Entrypoint}
-		entrypointParam := entrypointFile.ParamName()
-		entrypointContent, ok := request.Params.Arguments[entrypointParam].(string)
-		if !ok || entrypointContent == "" {
-			return nil, fmt.Errorf("%s file is required", sandboxConfig.Entrypoint)
+		metrics.Calls.WithLabelValues(sandboxConfig.Id).Inc()
+		result, err := callSandbox(ctx, sandboxConfig, request, options)
+		if err != nil || result.IsError {
+			metrics.Failures.WithLabelValues(sandboxConfig.Id).Inc()
 		}
+		return result, err
+	}
+}
 
-		// Create a temporary directory for the entrypoint file
-		dir, err := os.MkdirTemp("", sandboxConfig.Mount.TmpDirPrefix)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create a temporary directory: %v", err)
-		}
-		defer os.RemoveAll(dir)
+// callSandbox prepares the images of a sandbox and runs it, or its selected variants if it has a matrix
+func callSandbox(ctx context.Context, sandboxConfig *config.SandboxConfig, request mcp.CallToolRequest, options *handlerOptions) (*mcp.CallToolResult, error) {
+	// Build or pull the images of the sandbox if they are missing
+	if err := ensureImages(ctx, sandboxConfig, request, options); err != nil {
+		return nil, err
+	}
 
-		// Write the entrypoint to script file in the temp directory
-		cmdFile := filepath.Join(dir, sandboxConfig.Entrypoint)
-		if err := os.WriteFile(cmdFile, []byte(entrypointContent), sandboxConfig.Mount.ScriptPerms()); err != nil {
-			return nil, fmt.Errorf("failed to write command file: %v", err)
-		}
+	// Run the selected variants if the sandbox has a matrix
+	if sandboxConfig.HasMatrix() {
+		return runMatrix(ctx, sandboxConfig, request, options)
+	}
+	return runSandbox(ctx, sandboxConfig, request, options)
+}
 
-		// withFile ToolOption
-		// Get the contents of the required files from the request
-		for _, file := range sandboxConfig.Parameters.Files {
-			paramName := file.ParamName()
-			content, ok := request.Params.Arguments[paramName].(string)
-			if !ok || content == "" {
-				return nil, fmt.Errorf("%s file is required", file.Name)
-			}
+// runSandbox runs a sandbox with the files from the request and returns the result
+func runSandbox(ctx context.Context, sandboxConfig *config.SandboxConfig, request mcp.CallToolRequest, options *handlerOptions) (*mcp.CallToolResult, error) {
+	// withEntrypoint ToolOption
+	// Get the contents of the entrypoint file from the request
+	entrypointFile := config.SandboxFile{Name: sandboxConfig.Entrypoint}
+	entrypointParam := entrypointFile.ParamName()
+	entrypointContent, ok := request.Params.Arguments[entrypointParam].(string)
+	if !ok || entrypointContent == "" {
+		return nil, fmt.Errorf("%s file is required", sandboxConfig.Entrypoint)
+	}
 
-			filePath := filepath.Join(dir, file.Name)
-			if err := os.WriteFile(filePath, []byte(content), sandboxConfig.Mount.ScriptPerms()); err != nil {
-				return nil, fmt.Errorf("failed to write file %s: %v", file.Name, err)
-			}
+	// Create a temporary directory for the entrypoint file
+	dir, err := os.MkdirTemp("", sandboxConfig.Mount.TmpDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Write the entrypoint to script file in the temp directory
+	cmdFile := filepath.Join(dir, sandboxConfig.Entrypoint)
+	if err := os.WriteFile(cmdFile, []byte(entrypointContent), sandboxConfig.Mount.ScriptPerms()); err != nil {
+		return nil, fmt.Errorf("failed to write command file: %v", err)
+	}
+
+	// withFile ToolOption
+	// Get the contents of the required files from the request
+	for _, file := range sandboxConfig.Parameters.Files {
+		paramName := file.ParamName()
+		content, ok := request.Params.Arguments[paramName].(string)
+		if !ok || content == "" {
+			return nil, fmt.Errorf("%s file is required", file.Name)
 		}
 
-		// withAdditionalFiles ToolOption
-		// Handle additional files if provided
-		if files, ok := request.Params.Arguments["files"].([]any); ok {
-			for _, file := range files {
-				if fileMap, ok := file.(map[string]any); ok {
-					filename := fileMap["filename"].(string)
-					content := fileMap["content"].(string)
-
-					filePath := filepath.Join(dir, filename)
-					if err := os.WriteFile(filePath, []byte(content), sandboxConfig.Mount.ScriptPerms()); err != nil {
-						return nil, fmt.Errorf("failed to write file %s: %v", filename, err)
-					}
+		filePath := filepath.Join(dir, file.Name)
+		if err := os.WriteFile(filePath, []byte(content), sandboxConfig.Mount.ScriptPerms()); err != nil {
+			return nil, fmt.Errorf("failed to write file %s: %v", file.Name, err)
+		}
+	}
+
+	// withAdditionalFiles ToolOption
+	// Handle additional files if provided
+	if files, ok := request.Params.Arguments["files"].([]any); ok {
+		for _, file := range files {
+			if fileMap, ok := file.(map[string]any); ok {
+				filename := fileMap["filename"].(string)
+				content := fileMap["content"].(string)
+
+				filePath := filepath.Join(dir, filename)
+				if err := os.WriteFile(filePath, []byte(content), sandboxConfig.Mount.ScriptPerms()); err != nil {
+					return nil, fmt.Errorf("failed to write file %s: %v", filename, err)
 				}
 			}
 		}
+	}
+
+	// Wait until the sandbox is allowed to run
+	queued := time.Now()
+	release, err := acquire(ctx)
+	metrics.QueueWait.WithLabelValues(sandboxConfig.Id).Observe(time.Since(queued).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("cancelled while waiting to run the sandbox: %v", err)
+	}
+	defer release()
+
+	// Use the configured runtime or connect to Docker
+	cli, closeRuntime, err := options.openRuntime()
+	if err != nil {
+		return nil, err
+	}
+	defer closeRuntime()
+
+	// Create container config
+	containerConfig := &container.Config{
+		Image:      sandboxConfig.Image,
+		Cmd:        sandboxConfig.RunCommand(),
+		WorkingDir: sandboxConfig.Mount.WorkDir,
+		User:       sandboxConfig.User,
+		Tty:        sandboxConfig.Tty(),
+	}
 
-		// Initialize Docker client
-		cli, err := client.NewClientWithOpts(
-			// Let the client be configured through environment variables
-			client.FromEnv,
-			// Try to support whatever version of the daemon is available
-			client.WithAPIVersionNegotiation(),
-		)
+	// Create host config
+	network, err := sandboxNetwork(ctx, cli, sandboxConfig)
+	if err != nil {
+		return nil, err
+	}
+	hostConfig := newHostConfig(sandboxConfig, dir, network, sandboxConfig.Mount.ReadOnly)
+
+	// Run the setup command before the sandbox command if configured
+	if sandboxConfig.Setup != nil {
+		result, err := runSetup(ctx, cli, sandboxConfig, dir)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create Docker client: %v", err)
+			return nil, err
 		}
-		defer cli.Close()
-
-		// Create container config
-		containerConfig := &container.Config{
-			Image:      sandboxConfig.Image,
-			Cmd:        sandboxConfig.RunCommand(),
-			WorkingDir: sandboxConfig.Mount.WorkDir,
-			User:       sandboxConfig.User,
-			Tty:        sandboxConfig.Tty(),
+		if result != nil {
+			return result, nil
 		}
+	}
 
-		// Create host config
-		hostConfig := &container.HostConfig{
-			Resources: container.Resources{
-				Memory:    sandboxConfig.Resources.Memory * 1024 * 1024,
-				NanoCPUs:  int64(sandboxConfig.Resources.CPU * 1e9),
-				PidsLimit: &sandboxConfig.Resources.Processes,
-				Ulimits: []*container.Ulimit{
-					{
-						Name: "nofile",
-						Soft: sandboxConfig.Resources.Files,
-						Hard: sandboxConfig.Resources.Files,
-					},
-				},
-			},
-			NetworkMode:    container.NetworkMode(sandboxConfig.Security.Network),
-			ReadonlyRootfs: sandboxConfig.Security.ReadOnly,
-			Mounts: []mount.Mount{
-				{
-					Type:     mount.TypeBind,
-					Source:   dir,
-					Target:   sandboxConfig.Mount.WorkDir,
-					ReadOnly: sandboxConfig.Mount.ReadOnly,
-				},
-			},
-			CapDrop:     sandboxConfig.Security.CapDrop,
-			SecurityOpt: sandboxConfig.Security.SecurityOpt,
+	// Create execution context with timeout
+	execCtx, cancel := context.WithTimeout(ctx, sandboxConfig.Timeout())
+	defer cancel()
+
+	// Create container
+	created := time.Now()
+	resp, err := cli.ContainerCreate(execCtx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		return nil, createError(sandboxConfig, err)
+	}
+
+	// Ensure container cleanup
+	defer removeContainer(cli, resp.ID, sandboxConfig.Timeout())
+
+	// Nothing runs on the isolated network, the phases connect the sandbox to their networks
+	if network == isolatedNetwork {
+		if err := cli.NetworkDisconnect(execCtx, isolatedNetwork, resp.ID, true); err != nil {
+			return nil, fmt.Errorf("failed to disconnect from network %s: %v", isolatedNetwork, err)
+		}
+	}
+
+	// Start the container
+	if err := cli.ContainerStart(execCtx, resp.ID, container.StartOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to start container: %v", err)
+	}
+	started := time.Now()
+	metrics.ContainerStart.WithLabelValues(sandboxConfig.Id).Observe(started.Sub(created).Seconds())
+
+	// Record the execution once the container is done
+	metrics.Running.WithLabelValues(sandboxConfig.Id).Inc()
+	defer func() {
+		metrics.Running.WithLabelValues(sandboxConfig.Id).Dec()
+		metrics.RunDuration.WithLabelValues(sandboxConfig.Id).Observe(time.Since(started).Seconds())
+		if errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+			metrics.Timeouts.WithLabelValues(sandboxConfig.Id, metrics.StageRun).Inc()
 		}
+	}()
 
-		// Create execution context with timeout
-		execCtx, cancel := context.WithTimeout(ctx, sandboxConfig.Timeout())
-		defer cancel()
+	// Run the phases one after the other in the running container
+	if sandboxConfig.HasPhases() {
+		// Wait for container to be running
+		if err := waitForContainer(execCtx, cli, resp.ID, 10*time.Second); err != nil {
+			return nil, err
+		}
 
-		// Create container
-		resp, err := cli.ContainerCreate(execCtx, containerConfig, hostConfig, nil, nil, "")
+		result, err := runPhases(execCtx, cli, sandboxConfig, resp.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create container: %v", err)
+			if execCtx.Err() != nil {
+				return nil, fmt.Errorf("execution timeout after %d seconds", int(sandboxConfig.Timeout().Seconds()))
+			}
+			return nil, err
 		}
+		return reportOOM(execCtx, cli, sandboxConfig, resp.ID, result), nil
+	}
 
-		// Ensure container cleanup
-		defer func() {
-			killCtx, killCancel := context.WithTimeout(context.Background(), sandboxConfig.Timeout())
-			defer killCancel()
+	// Only exec Command if Before was used to start the container
+	if sandboxConfig.ExecCommand() != nil {
 
-			_ = cli.ContainerRemove(killCtx, resp.ID, container.RemoveOptions{
-				Force:         true,
-				RemoveVolumes: true,
-			})
-		}()
+		// Wait for container to be running
+		if err := waitForContainer(execCtx, cli, resp.ID, 10*time.Second); err != nil {
+			return nil, err
+		}
 
-		// Start the container
-		if err := cli.ContainerStart(execCtx, resp.ID, container.StartOptions{}); err != nil {
-			return nil, fmt.Errorf("failed to start container: %v", err)
+		stdout, stderr, exitCode, err := execInContainer(execCtx, cli, resp.ID, sandboxConfig.Command, sandboxConfig.User)
+		if err != nil {
+			if execCtx.Err() != nil {
+				return nil, fmt.Errorf("execution timeout after %d seconds", int(sandboxConfig.Timeout().Seconds()))
+			}
+			return nil, err
 		}
 
-		// Only exec Command if Before was used to start the container
-		if sandboxConfig.ExecCommand() != nil {
+		return reportOOM(execCtx, cli, sandboxConfig, resp.ID, newCommandResult(stdout, stderr, exitCode)), nil
+	}
 
-			// Wait for container to be running
-			if err := waitForContainer(execCtx, cli, resp.ID, 10*time.Second); err != nil {
-				return nil, err
-			}
+	// Wait for execution to finish
+	stdout, stderr, exitCode, err := waitForExit(execCtx, cli, resp.ID)
+	if err != nil {
+		if execCtx.Err() != nil {
+			return nil, fmt.Errorf("execution timeout after %d seconds", int(sandboxConfig.Timeout().Seconds()))
+		}
+		return nil, err
+	}
 
-			execConfig := container.ExecOptions{
-				Cmd:          sandboxConfig.Command,
-				AttachStdout: true,
-				AttachStderr: true,
-				User:         sandboxConfig.User,
-			}
+	return reportOOM(execCtx, cli, sandboxConfig, resp.ID, newCommandResult(stdout, stderr, int(exitCode))), nil
+}
 
-			execResp, err := cli.ContainerExecCreate(execCtx, resp.ID, execConfig)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create exec: %v", err)
-			}
+// createError explains a failure to create the container of a sandbox
+// A missing image is the most common cause, so it gets a hint on how to fix it
+func createError(sandboxConfig *config.SandboxConfig, err error) error {
+	if errdefs.IsNotFound(err) {
+		return fmt.Errorf("image %s of sandbox %s is missing, build it with `sandbox-mcp build %s` or set the imagePolicy to build or pull missing images: %v", sandboxConfig.Image, sandboxConfig.Id, sandboxConfig.Id, err)
+	}
+	return fmt.Errorf("failed to create container: %v", err)
+}
 
-			// Attach to the exec command to capture output
-			response, err := cli.ContainerExecAttach(execCtx, execResp.ID, container.ExecStartOptions{})
-			if err != nil {
-				return nil, fmt.Errorf("failed to attach to exec: %v", err)
-			}
-			defer response.Close()
+// oomKilled returns true if a container was killed because it ran out of memory
+func oomKilled(ctx context.Context, cli Runtime, containerID string) bool {
+	inspect, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return false
+	}
+	return inspect.State != nil && inspect.State.OOMKilled
+}
 
-			// Read stdout and stderr from the exec command
-			stdout := new(bytes.Buffer)
-			stderr := new(bytes.Buffer)
-			if _, err := stdcopy.StdCopy(stdout, stderr, response.Reader); err != nil {
-				return nil, fmt.Errorf("failed to read exec output: %v", err)
-			}
+// reportOOM explains the failure of a result if the sandbox ran out of memory
+// Processes executed in a running container are checked as well as its command
+func reportOOM(ctx context.Context, cli Runtime, sandboxConfig *config.SandboxConfig, containerID string, result *mcp.CallToolResult) *mcp.CallToolResult {
+	if !result.IsError || !oomKilled(ctx, cli, containerID) {
+		return result
+	}
 
-			// Wait for the exec command to complete
-			for {
-				inspectResp, err := cli.ContainerExecInspect(execCtx, execResp.ID)
-				if err != nil {
-					return nil, fmt.Errorf("failed to inspect exec: %v", err)
-				}
-				if !inspectResp.Running {
-					// Return error if exec command failed
-					if inspectResp.ExitCode != 0 {
-						if stderr.Len() > 0 {
-							return mcp.NewToolResultError(stderr.String()), nil
-						}
-						return mcp.NewToolResultError(fmt.Sprintf("Command failed with exit code %d", inspectResp.ExitCode)), nil
-					}
+	metrics.OOMKills.WithLabelValues(sandboxConfig.Id).Inc()
+	result.Content = append(result.Content, mcp.NewTextContent(
+		fmt.Sprintf("The sandbox was killed because it ran out of memory (limit %d MB).", sandboxConfig.Resources.Memory),
+	))
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta["oomKilled"] = true
+	return result
+}
 
-					// Include stderr in stdout if present
-					if stderr.Len() > 0 {
-						stdout.WriteString("\nStderr:\n")
-						stdout.Write(stderr.Bytes())
-					}
+// newCommandResult creates a tool result from the output of a command
+// The exit code is included in the metadata of the result
+func newCommandResult(stdout *bytes.Buffer, stderr *bytes.Buffer, exitCode int) *mcp.CallToolResult {
+	var result *mcp.CallToolResult
+	if exitCode != 0 {
+		// Return error if command failed
+		if stderr.Len() > 0 {
+			result = mcp.NewToolResultError(stderr.String())
+		} else {
+			result = mcp.NewToolResultError(fmt.Sprintf("Command failed with exit code %d", exitCode))
+		}
+	} else {
+		// Include stderr in stdout if present
+		if stderr.Len() > 0 {
+			stdout.WriteString("\nStderr:\n")
+			stdout.Write(stderr.Bytes())
+		}
+		result = mcp.NewToolResultText(stdout.String())
+	}
 
-					return mcp.NewToolResultText(stdout.String()), nil
-				}
-				time.Sleep(100 * time.Millisecond)
+	result.Meta = map[string]any{"exitCode": exitCode}
+	return result
+}
+
+// ExitCode returns the exit code of the command that produced a tool result
+// For failed phases, it is the exit code of the first phase that failed or timed out
+// Results without an exit code return 1 for errors and 0 otherwise
+func ExitCode(result *mcp.CallToolResult) int {
+	switch meta := result.Meta["exitCode"].(type) {
+	case int:
+		return meta
+	case float64:
+		// Results decoded from JSON store numbers as float64
+		return int(meta)
+	}
+
+	if result.IsError {
+		for _, phase := range resultPhases(result) {
+			if phase.ExitCode != 0 {
+				return phase.ExitCode
 			}
 		}
+	}
 
-		// Wait for execution to finish
-		statusCh, errCh := cli.ContainerWait(execCtx, resp.ID, container.WaitConditionNotRunning)
-		select {
-		case err := <-errCh:
-			if err != nil {
-				return nil, fmt.Errorf("error waiting for container: %v", err)
-			}
-		case status := <-statusCh:
-			// Get container logs
-			logs, err := cli.ContainerLogs(execCtx, resp.ID, container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-				Timestamps: false,
-				Follow:     false,
-			})
-			if err != nil {
-				return nil, fmt.Errorf("failed to get logs: %v", err)
-			}
-			defer logs.Close()
+	if result.IsError {
+		return 1
+	}
+	return 0
+}
 
-			// Read stdout and stderr
-			stdout := new(bytes.Buffer)
-			stderr := new(bytes.Buffer)
-			if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil {
-				return nil, fmt.Errorf("failed to read logs: %v", err)
-			}
+// resultPhases returns the phases in the metadata of a tool result
+// The metadata is either set by runPhases or decoded from JSON by a client
+func resultPhases(result *mcp.CallToolResult) []phaseResult {
+	raw, ok := result.Meta["phases"]
+	if !ok {
+		return nil
+	}
+	if phases, ok := raw.([]phaseResult); ok {
+		return phases
+	}
 
-			// Return error if command failed
-			if status.StatusCode != 0 {
-				return mcp.NewToolResultError(stderr.String()), nil
-			}
+	var phases []phaseResult
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &phases); err != nil {
+		return nil
+	}
+	return phases
+}
 
-			// Include stderr in stdout if present
-			if stderr.Len() > 0 {
-				stdout.WriteString("\nStderr:\n")
-				stdout.Write(stderr.Bytes())
+// newHostConfig creates the Docker host config for a sandbox container
+func newHostConfig(sandboxConfig *config.SandboxConfig, dir string, network string, readOnlyMount bool) *container.HostConfig {
+	return &container.HostConfig{
+		Resources: container.Resources{
+			Memory:    sandboxConfig.Resources.Memory * 1024 * 1024,
+			NanoCPUs:  int64(sandboxConfig.Resources.CPU * 1e9),
+			PidsLimit: &sandboxConfig.Resources.Processes,
+			Ulimits: []*container.Ulimit{
+				{
+					Name: "nofile",
+					Soft: sandboxConfig.Resources.Files,
+					Hard: sandboxConfig.Resources.Files,
+				},
+			},
+		},
+		NetworkMode:    container.NetworkMode(network),
+		ReadonlyRootfs: sandboxConfig.Security.ReadOnly,
+		Mounts: []mount.Mount{
+			{
+				Type:     mount.TypeBind,
+				Source:   dir,
+				Target:   sandboxConfig.Mount.WorkDir,
+				ReadOnly: readOnlyMount,
+			},
+		},
+		CapDrop:     sandboxConfig.Security.CapDrop,
+		SecurityOpt: sandboxConfig.Security.SecurityOpt,
+	}
+}
+
+// waitForExit waits for a container to exit and returns its output and exit code
+func waitForExit(ctx context.Context, cli Runtime, containerID string) (*bytes.Buffer, *bytes.Buffer, int64, error) {
+	statusCh, errCh := cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("error waiting for container: %v", err)
+		}
+	case status := <-statusCh:
+		// Get container logs
+		logs, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Timestamps: false,
+			Follow:     false,
+		})
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to get logs: %v", err)
+		}
+		defer logs.Close()
+
+		// Read stdout and stderr
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to read logs: %v", err)
+		}
+
+		return stdout, stderr, status.StatusCode, nil
+	case <-ctx.Done():
+		return nil, nil, 0, ctx.Err()
+	}
+
+	return nil, nil, 0, fmt.Errorf("unexpected error: container wait returned no result")
+}
+
+// removeContainer forcefully removes a container and its volumes
+func removeContainer(cli Runtime, containerID string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_ = cli.ContainerRemove(ctx, containerID, container.RemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	})
+}
+
+// runSetup runs the setup command of a sandbox in a separate container
+// The setup container shares the mounted directory with the sandbox so that
+// anything installed there is available to the command
+// Returns a tool result only if the setup command fails
+func runSetup(ctx context.Context, cli Runtime, sandboxConfig *config.SandboxConfig, dir string) (*mcp.CallToolResult, error) {
+	setupCtx, cancel := context.WithTimeout(ctx, sandboxConfig.SetupTimeout())
+	defer cancel()
+
+	containerConfig := &container.Config{
+		Image:      sandboxConfig.Image,
+		Cmd:        sandboxConfig.Setup.Command,
+		WorkingDir: sandboxConfig.Mount.WorkDir,
+		User:       sandboxConfig.User,
+	}
+
+	// The setup needs to write to the mounted directory
+	hostConfig := newHostConfig(sandboxConfig, dir, sandboxConfig.SetupNetwork(), false)
+
+	resp, err := cli.ContainerCreate(setupCtx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create setup container: %v", err)
+	}
+	defer removeContainer(cli, resp.ID, sandboxConfig.SetupTimeout())
+
+	if err := cli.ContainerStart(setupCtx, resp.ID, container.StartOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to start setup container: %v", err)
+	}
+
+	stdout, stderr, exitCode, err := waitForExit(setupCtx, cli, resp.ID)
+	if err != nil {
+		if setupCtx.Err() != nil {
+			if errors.Is(setupCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+				metrics.Timeouts.WithLabelValues(sandboxConfig.Id, metrics.StageSetup).Inc()
 			}
+			return nil, fmt.Errorf("setup timeout after %d seconds", int(sandboxConfig.SetupTimeout().Seconds()))
+		}
+		return nil, err
+	}
 
-			return mcp.NewToolResultText(stdout.String()), nil
-		case <-execCtx.Done():
-			return nil, fmt.Errorf("execution timeout after %d seconds", int(sandboxConfig.Timeout().Seconds()))
+	if exitCode != 0 {
+		output := stderr.String()
+		if output == "" {
+			output = stdout.String()
 		}
+		return mcp.NewToolResultError(fmt.Sprintf("Setup failed with exit code %d:\n%s", exitCode, output)), nil
+	}
+
+	return nil, nil
+}
+
+// describeImage describes the Docker image or the matrix variants of a sandbox
+func describeImage(sandboxConfig *config.SandboxConfig) string {
+	if !sandboxConfig.HasMatrix() {
+		return fmt.Sprintf("`%s` Docker image", sandboxConfig.Image)
+	}
 
-		return nil, fmt.Errorf("unexpected error: container wait returned no result")
+	variants := make([]string, 0, len(sandboxConfig.Matrix))
+	for _, variant := range sandboxConfig.Matrix {
+		variants = append(variants, fmt.Sprintf("%s (`%s`)", variant.Label, variant.Image))
 	}
+	return fmt.Sprintf("variants %s, which run concurrently and can be selected with the `variants` parameter", strings.Join(variants, ", "))
+}
+
+// describeCommand describes how the entrypoint of a sandbox is executed
+func describeCommand(sandboxConfig *config.SandboxConfig) string {
+	if !sandboxConfig.HasPhases() {
+		return fmt.Sprintf("with the command `%s`", strings.Join(sandboxConfig.Command, " "))
+	}
+
+	phases := make([]string, 0, len(sandboxConfig.Phases))
+	for i := range sandboxConfig.Phases {
+		phase := &sandboxConfig.Phases[i]
+		phases = append(phases, fmt.Sprintf("%s (`%s`)", phaseName(phase, i), strings.Join(phase.Command, " ")))
+	}
+	return fmt.Sprintf("in the phases %s, each reporting its own output and exit code", strings.Join(phases, ", then "))
 }
 
 // generateSandboxDescription creates a comprehensive description of the sandbox environment
@@ -331,8 +574,8 @@ func generateSandboxDescription(sandboxConfig *config.SandboxConfig) string {
 		coreText = "core"
 	}
 
-	description += fmt.Sprintf("This sandbox uses the `%s` Docker image, with %d CPU %s, %d MB RAM, and %d processes.",
-		sandboxConfig.Image,
+	description += fmt.Sprintf("This sandbox uses the %s, with %d CPU %s, %d MB RAM, and %d processes.",
+		describeImage(sandboxConfig),
 		sandboxConfig.Resources.CPU,
 		coreText,
 		sandboxConfig.Resources.Memory,
@@ -351,6 +594,17 @@ func generateSandboxDescription(sandboxConfig *config.SandboxConfig) string {
 		description += " and read-write filesystem permissions."
 	}
 
+	// Add information about the setup step
+	if sandboxConfig.Setup != nil {
+		setupNetwork := sandboxConfig.SetupNetwork()
+		if setupNetwork == "none" {
+			setupNetwork = "no"
+		}
+		description += fmt.Sprintf(" Before the code is executed, the setup command `%s` is run with %s network access.",
+			strings.Join(sandboxConfig.Setup.Command, " "),
+			setupNetwork)
+	}
+
 	// Add information about required files
 	if len(sandboxConfig.Parameters.Files) > 0 {
 		if len(sandboxConfig.Parameters.Files) == 1 {
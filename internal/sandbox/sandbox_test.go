@@ -0,0 +1,574 @@
+package sandbox_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox/sandboxtest"
+)
+
+var _ sandbox.Runtime = (*sandboxtest.Runtime)(nil)
+
+// newConfig creates a shell sandbox config for the tests
+func newConfig() *config.SandboxConfig {
+	return &config.SandboxConfig{
+		Id:         "shell",
+		Image:      "sandbox-mcp/shell:latest",
+		User:       "sandbox",
+		Entrypoint: "main.sh",
+		TimeoutRaw: 5,
+		Command:    []string{"sh", "main.sh"},
+		Security: config.SandboxSecurity{
+			CapDrop: []string{"all"},
+			Network: "none",
+		},
+		Resources: config.SandboxResources{CPU: 1, Memory: 64, Processes: 64, Files: 64},
+		Mount: config.SandboxMount{
+			WorkDir:        "/sandbox",
+			TmpDirPrefix:   "sandbox-mcp-test-",
+			ScriptPermsRaw: "0755",
+		},
+	}
+}
+
+// newRequest creates a tool call request with the given arguments
+func newRequest(arguments map[string]any) mcp.CallToolRequest {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "shell"
+	request.Params.Arguments = arguments
+	return request
+}
+
+// callHandler calls the handler of a sandbox with a fake runtime
+func callHandler(t *testing.T, sandboxConfig *config.SandboxConfig, runtime *sandboxtest.Runtime, arguments map[string]any) (*mcp.CallToolResult, error) {
+	t.Helper()
+	if arguments == nil {
+		arguments = map[string]any{"main_sh": "echo hello"}
+	}
+	handler := sandbox.NewSandboxToolHandler(sandboxConfig, sandbox.WithRuntime(runtime))
+	return handler(context.Background(), newRequest(arguments))
+}
+
+// resultText joins the text contents of a tool result
+func resultText(result *mcp.CallToolResult) string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// assertCleanedUp checks that all containers and mounted directories were removed
+func assertCleanedUp(t *testing.T, runtime *sandboxtest.Runtime) {
+	t.Helper()
+	for _, c := range runtime.Containers() {
+		if !c.Removed {
+			t.Errorf("container %s was not removed", c.ID)
+		}
+		for _, m := range c.HostConfig.Mounts {
+			if _, err := os.Stat(m.Source); !os.IsNotExist(err) {
+				t.Errorf("mounted directory %s was not removed", m.Source)
+			}
+		}
+	}
+}
+
+func TestHandlerRunsCommand(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{Stdout: "hello\n", Stderr: "warning\n"})
+
+	result, err := callHandler(t, newConfig(), runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Errorf("expected a successful result, got an error: %s", resultText(result))
+	}
+	if text := resultText(result); text != "hello\n\nStderr:\nwarning\n" {
+		t.Errorf("unexpected output %q", text)
+	}
+	if code := sandbox.ExitCode(result); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+
+	containers := runtime.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+	c := containers[0]
+	if c.Config.Tty {
+		t.Error("expected the container to run without a TTY")
+	}
+	if string(c.HostConfig.NetworkMode) != "none" {
+		t.Errorf("expected network none, got %s", c.HostConfig.NetworkMode)
+	}
+	if len(runtime.Execs()) != 0 {
+		t.Errorf("expected no execs, got %d", len(runtime.Execs()))
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerReturnsCommandFailure(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Default = sandboxtest.Script{Stdout: "partial output", Stderr: "sh: main.sh: not found\n", ExitCode: 127}
+
+	result, err := callHandler(t, newConfig(), runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected an error result")
+	}
+	if text := resultText(result); text != "sh: main.sh: not found\n" {
+		t.Errorf("unexpected output %q", text)
+	}
+	if code := sandbox.ExitCode(result); code != 127 {
+		t.Errorf("expected exit code 127, got %d", code)
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerReportsOOM(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Default = sandboxtest.Script{ExitCode: 137, OOMKilled: true}
+
+	result, err := callHandler(t, newConfig(), runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected an error result")
+	}
+	if text := resultText(result); !strings.Contains(text, "ran out of memory (limit 64 MB)") {
+		t.Errorf("expected an out of memory message, got %q", text)
+	}
+	if result.Meta["oomKilled"] != true {
+		t.Error("expected oomKilled in the result metadata")
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerTimesOut(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Default = sandboxtest.Script{Delay: time.Minute}
+
+	sandboxConfig := newConfig()
+	sandboxConfig.TimeoutRaw = 1
+
+	start := time.Now()
+	_, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err == nil || !strings.Contains(err.Error(), "execution timeout after 1 seconds") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the handler to return after the timeout, took %v", elapsed)
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerExecsCommandAfterBefore(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"docker-start"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{Stdout: "Server: APISIX\n"})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Before = []string{"docker-start"}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := resultText(result); text != "Server: APISIX\n" {
+		t.Errorf("unexpected output %q", text)
+	}
+
+	containers := runtime.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+	if got := strings.Join(containers[0].Config.Cmd, " "); got != "docker-start" {
+		t.Errorf("expected the container to run the before command, got %q", got)
+	}
+	if !containers[0].Config.Tty {
+		t.Error("expected the container to run with a TTY")
+	}
+
+	execs := runtime.Execs()
+	if len(execs) != 1 || strings.Join(execs[0].Cmd, " ") != "sh main.sh" {
+		t.Errorf("expected the command to be executed, got %+v", execs)
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerReturnsExecFailure(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"docker-start"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{ExitCode: 2})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Before = []string{"docker-start"}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || resultText(result) != "Command failed with exit code 2" {
+		t.Errorf("expected an exit code error, got %q", resultText(result))
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerReturnsExecError(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"docker-start"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{ExecError: errors.New("exec failed")})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Before = []string{"docker-start"}
+
+	_, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to create exec: exec failed") {
+		t.Errorf("expected an exec error, got %v", err)
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerTimesOutExec(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"docker-start"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{Delay: time.Minute})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Before = []string{"docker-start"}
+	sandboxConfig.TimeoutRaw = 2
+
+	_, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err == nil || !strings.Contains(err.Error(), "execution timeout after 2 seconds") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerReturnsCreateError(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.CreateError = errors.New("No such image: sandbox-mcp/shell:latest")
+
+	_, err := callHandler(t, newConfig(), runtime, nil)
+	if err == nil || !strings.Contains(err.Error(), "No such image") {
+		t.Errorf("expected a create error, got %v", err)
+	}
+}
+
+func TestHandlerRequiresEntrypoint(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+
+	_, err := callHandler(t, newConfig(), runtime, map[string]any{})
+	if err == nil || err.Error() != "main.sh file is required" {
+		t.Errorf("expected a missing entrypoint error, got %v", err)
+	}
+	if len(runtime.Containers()) != 0 {
+		t.Error("expected no containers to be created")
+	}
+}
+
+func TestHandlerRunsSetup(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"pip", "install", "-r", "requirements.txt"}, sandboxtest.Script{Stdout: "Installed\n"})
+	runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{Stdout: "hello\n"})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Setup = &config.SandboxSetup{
+		Command: []string{"pip", "install", "-r", "requirements.txt"},
+		Network: "bridge",
+	}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := resultText(result); text != "hello\n" {
+		t.Errorf("unexpected output %q", text)
+	}
+
+	containers := runtime.Containers()
+	if len(containers) != 2 {
+		t.Fatalf("expected a setup and a sandbox container, got %d", len(containers))
+	}
+	if string(containers[0].HostConfig.NetworkMode) != "bridge" {
+		t.Errorf("expected the setup to run with network bridge, got %s", containers[0].HostConfig.NetworkMode)
+	}
+	if string(containers[1].HostConfig.NetworkMode) != "none" {
+		t.Errorf("expected the command to run with network none, got %s", containers[1].HostConfig.NetworkMode)
+	}
+	if containers[0].HostConfig.Mounts[0].Source != containers[1].HostConfig.Mounts[0].Source {
+		t.Error("expected the setup and the command to share the mounted directory")
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerSetupFilesAreVisibleToCommand(t *testing.T) {
+	setup := []string{"pip", "install", "--target", "deps", "-r", "requirements.txt"}
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script(setup, sandboxtest.Script{Files: map[string]string{"deps/requests/__init__.py": ""}})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Setup = &config.SandboxSetup{Command: setup}
+
+	if _, err := callHandler(t, sandboxConfig, runtime, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	containers := runtime.Containers()
+	if len(containers) != 2 {
+		t.Fatalf("expected a setup and a sandbox container, got %d", len(containers))
+	}
+	if !slices.Contains(containers[1].Files, "deps/requests/__init__.py") {
+		t.Errorf("expected the files installed by the setup in the working directory of the command, got %v", containers[1].Files)
+	}
+	if !slices.Contains(containers[1].Files, "main.sh") {
+		t.Errorf("expected the entrypoint in the working directory of the command, got %v", containers[1].Files)
+	}
+}
+
+func TestHandlerStopsOnSetupFailure(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"pip", "install", "-r", "requirements.txt"}, sandboxtest.Script{Stderr: "No matching distribution\n", ExitCode: 1})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Setup = &config.SandboxSetup{Command: []string{"pip", "install", "-r", "requirements.txt"}}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError || !strings.Contains(resultText(result), "No matching distribution") {
+		t.Errorf("expected a setup error, got %q", resultText(result))
+	}
+	if len(runtime.Containers()) != 1 {
+		t.Errorf("expected only the setup container, got %d", len(runtime.Containers()))
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerRunsPhases(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"sleep", "infinity"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"cargo", "fetch"}, sandboxtest.Script{Stdout: "fetched\n"})
+	runtime.Script([]string{"cargo", "build"}, sandboxtest.Script{Stderr: "error[E0432]\n", ExitCode: 101})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Phases = []config.SandboxPhase{
+		{Name: "fetch", Command: []string{"cargo", "fetch"}, Network: "bridge"},
+		{Name: "build", Command: []string{"cargo", "build"}},
+		{Name: "run", Command: []string{"./target/debug/main"}},
+	}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected an error result")
+	}
+	if code := sandbox.ExitCode(result); code != 101 {
+		t.Errorf("expected exit code 101, got %d", code)
+	}
+
+	text := resultText(result)
+	for _, want := range []string{
+		"Phase `fetch` exited with code 0.\nfetched",
+		"Phase `build` exited with code 101.\nStderr:\nerror[E0432]",
+		"Phase `run` was skipped",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in %q", want, text)
+		}
+	}
+
+	// The sandbox is created on the isolated network and starts without a network,
+	// then it is connected to the network of the fetch phase and leaves it for the build phase
+	containers := runtime.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+	if string(containers[0].HostConfig.NetworkMode) != "sandbox-mcp-isolated" {
+		t.Errorf("expected the sandbox to be created on the isolated network, got %s", containers[0].HostConfig.NetworkMode)
+	}
+	if options, ok := runtime.Network("sandbox-mcp-isolated"); !ok || !options.Internal || options.Options["com.docker.network.bridge.enable_icc"] != "false" {
+		t.Errorf("expected an internal network without communication between containers, got %+v", options)
+	}
+	if len(containers[0].StartNetworks) != 0 {
+		t.Errorf("expected the sandbox to start without a network, got %v", containers[0].StartNetworks)
+	}
+	if len(containers[0].Networks) != 0 {
+		t.Errorf("expected the sandbox to be disconnected, got %v", containers[0].Networks)
+	}
+	if len(runtime.Execs()) != 2 {
+		t.Errorf("expected 2 executed phases, got %d", len(runtime.Execs()))
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerFailsWhenPhasesContinueOnError(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"sleep", "infinity"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"lint"}, sandboxtest.Script{ExitCode: 1})
+	runtime.Script([]string{"test"}, sandboxtest.Script{ExitCode: 1})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Phases = []config.SandboxPhase{
+		{Name: "lint", Command: []string{"lint"}, ContinueOnError: true},
+		{Command: []string{"test"}, ContinueOnError: true},
+	}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected an error result when every phase failed")
+	}
+	// Phases without a name are named by their position
+	if text := resultText(result); !strings.Contains(text, "Phase `2` exited with code 1.") {
+		t.Errorf("expected the unnamed phase by its position in %q", text)
+	}
+	if len(runtime.Execs()) != 2 {
+		t.Errorf("expected 2 executed phases, got %d", len(runtime.Execs()))
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerExitCodeOfPhaseThatContinuedOnError(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"sleep", "infinity"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"lint"}, sandboxtest.Script{ExitCode: 3})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Phases = []config.SandboxPhase{
+		{Name: "lint", Command: []string{"lint"}, ContinueOnError: true},
+		{Name: "test", Command: []string{"test"}},
+	}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected an error result when a phase failed")
+	}
+
+	// The failed phase decides the exit code, not the last phase that succeeded
+	if code := sandbox.ExitCode(result); code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerStopsAfterPhaseTimeout(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Script([]string{"sleep", "infinity"}, sandboxtest.Script{Delay: time.Hour})
+	runtime.Script([]string{"serve"}, sandboxtest.Script{Delay: time.Minute})
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Phases = []config.SandboxPhase{
+		{Name: "serve", Command: []string{"serve"}, TimeoutRaw: 1, ContinueOnError: true},
+		{Name: "test", Command: []string{"test"}},
+	}
+
+	result, err := callHandler(t, sandboxConfig, runtime, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("expected an error result")
+	}
+	text := resultText(result)
+	for _, want := range []string{"Phase `serve` timed out after 1 seconds.", "Phase `test` was skipped"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in %q", want, text)
+		}
+	}
+	if code := sandbox.ExitCode(result); code != 124 {
+		t.Errorf("expected exit code 124 of a timeout, got %d", code)
+	}
+	if len(runtime.Execs()) != 1 {
+		t.Errorf("expected the phases after the timeout not to run, got %d execs", len(runtime.Execs()))
+	}
+	assertCleanedUp(t, runtime)
+}
+
+func TestHandlerReportsOOMOfExec(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*config.SandboxConfig)
+	}{
+		{"command after before", func(c *config.SandboxConfig) {
+			c.Before = []string{"docker-start"}
+		}},
+		{"phase", func(c *config.SandboxConfig) {
+			c.Phases = []config.SandboxPhase{{Name: "run", Command: []string{"sh", "main.sh"}}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := sandboxtest.NewRuntime()
+			runtime.Script([]string{"docker-start"}, sandboxtest.Script{Delay: time.Hour})
+			runtime.Script([]string{"sleep", "infinity"}, sandboxtest.Script{Delay: time.Hour})
+			runtime.Script([]string{"sh", "main.sh"}, sandboxtest.Script{ExitCode: 137, OOMKilled: true})
+
+			sandboxConfig := newConfig()
+			tt.config(sandboxConfig)
+
+			result, err := callHandler(t, sandboxConfig, runtime, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.IsError || result.Meta["oomKilled"] != true {
+				t.Errorf("expected an out of memory result, got %+v", result)
+			}
+			if text := resultText(result); !strings.Contains(text, "ran out of memory (limit 64 MB)") {
+				t.Errorf("expected an out of memory message, got %q", text)
+			}
+			assertCleanedUp(t, runtime)
+		})
+	}
+}
+
+func TestHandlerRunsMatrix(t *testing.T) {
+	runtime := sandboxtest.NewRuntime()
+	runtime.Default = sandboxtest.Script{Stdout: "ok\n"}
+
+	sandboxConfig := newConfig()
+	sandboxConfig.Matrix = []config.SandboxVariant{
+		{Label: "3.9", Image: "python:3.9"},
+		{Label: "3.12", Image: "python:3.12"},
+	}
+
+	result, err := callHandler(t, sandboxConfig, runtime, map[string]any{
+		"main_sh":  "echo ok",
+		"variants": []any{"3.12"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := resultText(result); !strings.Contains(text, "| 3.12 | `python:3.12` | passed |") || strings.Contains(text, "3.9") {
+		t.Errorf("expected only the 3.12 variant in %q", text)
+	}
+
+	containers := runtime.Containers()
+	if len(containers) != 1 || containers[0].Config.Image != "python:3.12" {
+		t.Errorf("expected a single container with the 3.12 image, got %+v", containers)
+	}
+	assertCleanedUp(t, runtime)
+}
@@ -0,0 +1,564 @@
+// Package sandboxtest provides a fake container runtime to test sandbox handlers without Docker
+package sandboxtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Script describes how a command behaves in the fake runtime
+type Script struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// Delay is how long the command runs before it exits
+	Delay time.Duration
+	// OOMKilled makes the command exit as if it ran out of memory
+	OOMKilled bool
+	// ExecError is returned when the command is executed in a running container
+	ExecError error
+	// Files are written to the mounted working directory when the command starts,
+	// like the files that a command creates, by their path relative to the directory
+	Files map[string]string
+}
+
+// Container is a container created in the fake runtime
+type Container struct {
+	ID         string
+	Config     *container.Config
+	HostConfig *container.HostConfig
+	// Networks are the networks the container is connected to
+	Networks []string
+	// StartNetworks are the networks the container was connected to when it started
+	StartNetworks []string
+	Started       bool
+	Removed       bool
+	// Files are the files in the mounted working directory when the container started
+	Files []string
+
+	script  Script
+	startAt time.Time
+	// oomKilled is set when an exec runs out of memory
+	oomKilled bool
+}
+
+// Exec is a command executed in a running container of the fake runtime
+type Exec struct {
+	ID          string
+	ContainerID string
+	Cmd         []string
+
+	script   Script
+	finished bool
+}
+
+// Runtime is an in-memory container runtime that runs scripts instead of commands
+// It is safe for concurrent use
+type Runtime struct {
+	// Scripts maps commands joined with spaces to their behavior
+	Scripts map[string]Script
+	// Default is the behavior of commands without a script
+	Default Script
+	// CreateError is returned when a container is created
+	CreateError error
+	// StartError is returned when a container is started
+	StartError error
+	// PullError is returned when an image is pulled
+	PullError error
+
+	mu         sync.Mutex
+	nextID     int
+	containers map[string]*Container
+	execs      map[string]*Exec
+	order      []string
+	// images maps the local images to their labels
+	images map[string]map[string]string
+	pulls  []string
+	builds []string
+	// networks maps the created networks to their options
+	networks map[string]network.CreateOptions
+}
+
+// NewRuntime creates a fake runtime where commands without a script succeed without output
+func NewRuntime() *Runtime {
+	return &Runtime{
+		Scripts:    make(map[string]Script),
+		containers: make(map[string]*Container),
+		execs:      make(map[string]*Exec),
+		networks:   make(map[string]network.CreateOptions),
+		images:     make(map[string]map[string]string),
+	}
+}
+
+// Script sets the behavior of a command
+func (r *Runtime) Script(cmd []string, script Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Scripts[strings.Join(cmd, " ")] = script
+}
+
+// Containers returns the containers created in the runtime in creation order
+func (r *Runtime) Containers() []Container {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	containers := make([]Container, 0, len(r.order))
+	for _, id := range r.order {
+		containers = append(containers, *r.containers[id])
+	}
+	return containers
+}
+
+// Execs returns the commands executed in running containers
+func (r *Runtime) Execs() []Exec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	execs := make([]Exec, 0, len(r.execs))
+	for i := 1; i <= r.nextID; i++ {
+		if exec, ok := r.execs[fmt.Sprintf("exec-%d", i)]; ok {
+			execs = append(execs, *exec)
+		}
+	}
+	return execs
+}
+
+// AddImage makes an image available locally
+func (r *Runtime) AddImage(ref string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.images[ref] = nil
+}
+
+// RemoveImage removes a local image, like docker rmi
+func (r *Runtime) RemoveImage(ref string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.images, ref)
+}
+
+// Pulls returns the images pulled in the runtime in order
+func (r *Runtime) Pulls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.pulls)
+}
+
+// Builds returns the tags of the images built in the runtime in order
+func (r *Runtime) Builds() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.builds)
+}
+
+// scriptFor returns the behavior of a command
+func (r *Runtime) scriptFor(cmd []string) Script {
+	if script, ok := r.Scripts[strings.Join(cmd, " ")]; ok {
+		return script
+	}
+	return r.Default
+}
+
+// container returns a container that was not removed
+func (r *Runtime) container(id string) (*Container, error) {
+	c, ok := r.containers[id]
+	if !ok || c.Removed {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+	return c, nil
+}
+
+// exited returns true if the command of a started container has exited
+func (c *Container) exited() bool {
+	return c.Started && time.Since(c.startAt) >= c.script.Delay
+}
+
+// ContainerCreate creates a container that runs the script of its command when started
+func (r *Runtime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.CreateError != nil {
+		return container.CreateResponse{}, r.CreateError
+	}
+
+	r.nextID++
+	id := fmt.Sprintf("container-%d", r.nextID)
+	c := &Container{
+		ID:         id,
+		Config:     config,
+		HostConfig: hostConfig,
+		script:     r.scriptFor(config.Cmd),
+	}
+	if mode := string(hostConfig.NetworkMode); mode != "" && mode != "none" {
+		c.Networks = []string{mode}
+	}
+	r.containers[id] = c
+	r.order = append(r.order, id)
+
+	return container.CreateResponse{ID: id}, nil
+}
+
+// ContainerStart starts running the script of a container
+func (r *Runtime) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.StartError != nil {
+		return r.StartError
+	}
+	c, err := r.container(containerID)
+	if err != nil {
+		return err
+	}
+	c.Started = true
+	c.StartNetworks = slices.Clone(c.Networks)
+	c.startAt = time.Now()
+	return c.writeFiles()
+}
+
+// workDir returns the host directory mounted at the working directory of a container
+func (c *Container) workDir() string {
+	for _, m := range c.HostConfig.Mounts {
+		if m.Target == c.Config.WorkingDir {
+			return m.Source
+		}
+	}
+	return ""
+}
+
+// writeFiles records the files in the mounted working directory and writes the files of the script
+func (c *Container) writeFiles() error {
+	dir := c.workDir()
+	if dir == "" {
+		return nil
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		c.Files = append(c.Files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, content := range c.script.Files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContainerInspect returns the state of a container
+func (r *Runtime) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.container(containerID)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+
+	exited := c.exited()
+	state := &container.State{
+		Running:   c.Started && !exited,
+		OOMKilled: (exited && c.script.OOMKilled) || c.oomKilled,
+	}
+	if exited {
+		state.ExitCode = c.script.ExitCode
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{ID: c.ID, State: state},
+		Config:            c.Config,
+	}, nil
+}
+
+// ContainerWait waits for the script of a container to exit
+func (r *Runtime) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	statusCh := make(chan container.WaitResponse, 1)
+	errCh := make(chan error, 1)
+
+	r.mu.Lock()
+	c, err := r.container(containerID)
+	if err != nil {
+		r.mu.Unlock()
+		errCh <- err
+		return statusCh, errCh
+	}
+	remaining := c.script.Delay - time.Since(c.startAt)
+	script := c.script
+	r.mu.Unlock()
+
+	go func() {
+		select {
+		case <-time.After(remaining):
+			statusCh <- container.WaitResponse{StatusCode: int64(script.ExitCode)}
+		case <-ctx.Done():
+			errCh <- ctx.Err()
+		}
+	}()
+
+	return statusCh, errCh
+}
+
+// ContainerLogs returns the output of the script of a container
+func (r *Runtime) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.container(containerID)
+	if err != nil {
+		return nil, err
+	}
+	if !c.exited() {
+		return io.NopCloser(&bytes.Buffer{}), nil
+	}
+	return io.NopCloser(multiplex(c.script)), nil
+}
+
+// ContainerRemove removes a container
+func (r *Runtime) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.container(containerID)
+	if err != nil {
+		return err
+	}
+	c.Removed = true
+	return nil
+}
+
+// ContainerExecCreate creates an exec that runs the script of its command
+func (r *Runtime) ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.container(containerID)
+	if err != nil {
+		return container.ExecCreateResponse{}, err
+	}
+	if !c.Started || c.exited() {
+		return container.ExecCreateResponse{}, fmt.Errorf("container %s is not running", containerID)
+	}
+
+	script := r.scriptFor(options.Cmd)
+	if script.ExecError != nil {
+		return container.ExecCreateResponse{}, script.ExecError
+	}
+
+	r.nextID++
+	id := fmt.Sprintf("exec-%d", r.nextID)
+	r.execs[id] = &Exec{ID: id, ContainerID: containerID, Cmd: options.Cmd, script: script}
+	return container.ExecCreateResponse{ID: id}, nil
+}
+
+// ContainerExecAttach starts the script of an exec and streams its output after its delay
+// Closing the response before the delay stops the script
+func (r *Runtime) ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+	r.mu.Lock()
+	exec, ok := r.execs[execID]
+	r.mu.Unlock()
+	if !ok {
+		return types.HijackedResponse{}, fmt.Errorf("no such exec: %s", execID)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		defer serverConn.Close()
+
+		// A read on the server side only returns when the client closes the connection
+		closed := make(chan struct{})
+		go func() {
+			_, _ = serverConn.Read(make([]byte, 1))
+			close(closed)
+		}()
+
+		select {
+		case <-time.After(exec.script.Delay):
+		case <-closed:
+			return
+		}
+
+		_, _ = io.Copy(serverConn, multiplex(exec.script))
+
+		r.mu.Lock()
+		exec.finished = true
+		if c, ok := r.containers[exec.ContainerID]; ok && exec.script.OOMKilled {
+			c.oomKilled = true
+		}
+		r.mu.Unlock()
+	}()
+
+	return types.HijackedResponse{Conn: clientConn, Reader: bufio.NewReader(clientConn)}, nil
+}
+
+// ContainerExecInspect returns the state of an exec
+func (r *Runtime) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exec, ok := r.execs[execID]
+	if !ok {
+		return container.ExecInspect{}, fmt.Errorf("no such exec: %s", execID)
+	}
+
+	inspect := container.ExecInspect{ExecID: exec.ID, ContainerID: exec.ContainerID, Running: !exec.finished}
+	if exec.finished {
+		inspect.ExitCode = exec.script.ExitCode
+	}
+	return inspect, nil
+}
+
+// Network returns the options of a network created in the runtime
+func (r *Runtime) Network(name string) (network.CreateOptions, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	options, ok := r.networks[name]
+	return options, ok
+}
+
+// NetworkConnect connects a container to a network
+// Like Docker, containers without a network or with the network of the host or another container cannot be connected
+func (r *Runtime) NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.container(containerID)
+	if err != nil {
+		return err
+	}
+	if mode := c.HostConfig.NetworkMode; mode.IsNone() || mode.IsHost() || mode.IsContainer() {
+		return fmt.Errorf("container %s with network mode %s cannot be connected to network %s", containerID, mode, networkID)
+	}
+	c.Networks = append(c.Networks, networkID)
+	return nil
+}
+
+// NetworkDisconnect disconnects a container from a network
+func (r *Runtime) NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.container(containerID)
+	if err != nil {
+		return err
+	}
+	for i, name := range c.Networks {
+		if name == networkID {
+			c.Networks = append(c.Networks[:i], c.Networks[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("container %s is not connected to network %s", containerID, networkID)
+}
+
+// NetworkInspect returns a network created in the runtime
+func (r *Runtime) NetworkInspect(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	created, ok := r.networks[networkID]
+	if !ok {
+		return network.Inspect{}, errdefs.NotFound(fmt.Errorf("network %s not found", networkID))
+	}
+	return network.Inspect{Name: networkID, Internal: created.Internal, Options: created.Options}, nil
+}
+
+// NetworkCreate creates a network
+func (r *Runtime) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.networks[name]; ok {
+		return network.CreateResponse{}, errdefs.Conflict(fmt.Errorf("network with name %s already exists", name))
+	}
+	r.networks[name] = options
+	return network.CreateResponse{ID: name}, nil
+}
+
+// ImageInspect returns a local image with the labels it was built with
+func (r *Runtime) ImageInspect(ctx context.Context, imageID string, inspectOpts ...client.ImageInspectOption) (image.InspectResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	labels, ok := r.images[imageID]
+	if !ok {
+		return image.InspectResponse{}, errdefs.NotFound(fmt.Errorf("no such image: %s", imageID))
+	}
+	return image.InspectResponse{ID: imageID, Config: &container.Config{Labels: labels}}, nil
+}
+
+// ImagePull makes an image available locally unless the pull error is set
+func (r *Runtime) ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.PullError != nil {
+		return nil, r.PullError
+	}
+	r.pulls = append(r.pulls, ref)
+	r.images[ref] = nil
+	return io.NopCloser(strings.NewReader(fmt.Sprintf(`{"status":"Pulled %s"}`+"\n", ref))), nil
+}
+
+// ImageBuild reads the build context and makes the tagged images available locally
+func (r *Runtime) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	if _, err := io.Copy(io.Discard, buildContext); err != nil {
+		return types.ImageBuildResponse{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, tag := range options.Tags {
+		r.builds = append(r.builds, tag)
+		r.images[tag] = options.Labels
+	}
+	body := fmt.Sprintf(`{"stream":"Built %s\n"}`+"\n", strings.Join(options.Tags, ", "))
+	return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+// multiplex encodes the output of a script like the Docker API does for non-TTY containers
+func multiplex(script Script) *bytes.Buffer {
+	var b bytes.Buffer
+	if script.Stdout != "" {
+		_, _ = stdcopy.NewStdWriter(&b, stdcopy.Stdout).Write([]byte(script.Stdout))
+	}
+	if script.Stderr != "" {
+		_, _ = stdcopy.NewStdWriter(&b, stdcopy.Stderr).Write([]byte(script.Stderr))
+	}
+	return &b
+}
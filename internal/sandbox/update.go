@@ -0,0 +1,408 @@
+package sandbox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// SandboxUpdate describes how an installed sandbox differs from its upstream version
+type SandboxUpdate struct {
+	Id string
+	// Installed is false if the sandbox is only available upstream
+	Installed bool
+	// LocalVersion is the version recorded when the sandbox was installed
+	LocalVersion    string
+	UpstreamVersion string
+	// Changed is true if the upstream sandbox changed since it was installed
+	Changed bool
+	// Modified is true if the installed sandbox was changed locally
+	Modified bool
+	// Files are the files that differ between the installed and the upstream sandbox
+	Files []FileChange
+}
+
+// FileChange is a file that differs between the installed and the upstream sandbox
+type FileChange struct {
+	Path string
+	// Status is A if the file was added upstream, D if it was removed upstream and M if it differs
+	Status string
+}
+
+// UpdatePlan holds the upstream sandboxes of a source to compare and update the installed sandboxes
+type UpdatePlan struct {
+	Updates []SandboxUpdate
+
+	destPath    string
+	source      appconfig.Source
+	upstreamDir string
+	lock        *Lockfile
+}
+
+// UpdateOptions configures which installed sandboxes are compared with a source
+type UpdateOptions struct {
+	// Sandboxes limits the update to the given sandbox ids
+	Sandboxes []string
+	// AnySource compares sandboxes that were installed from another source as well
+	AnySource bool
+	// Insecure fetches releases without verifying their checksums
+	Insecure bool
+}
+
+// PlanUpdate fetches the upstream sandboxes of a source and compares them with the installed sandboxes
+// Sandboxes installed from another source are left out unless AnySource is set
+// The plan must be closed to remove the fetched sandboxes
+func PlanUpdate(destPath string, source appconfig.Source, opts UpdateOptions) (*UpdatePlan, error) {
+	lock, err := LoadLockfile(destPath)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamDir, err := os.MkdirTemp("", "sandbox-mcp-upstream-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	plan := &UpdatePlan{destPath: destPath, source: source, upstreamDir: upstreamDir, lock: lock}
+
+	fetched, err := fetchSource(upstreamDir, source, PullOptions{Force: true, Sandboxes: opts.Sandboxes, Insecure: opts.Insecure})
+	if err != nil {
+		plan.Close()
+		return nil, err
+	}
+	sort.Strings(fetched)
+
+	for _, id := range fetched {
+		if entry, ok := lock.Sandboxes[id]; ok && !opts.AnySource && entry.Source != source.URL {
+			continue
+		}
+		update, err := plan.compare(id)
+		if err != nil {
+			plan.Close()
+			return nil, err
+		}
+		plan.Updates = append(plan.Updates, update)
+	}
+	return plan, nil
+}
+
+// Close removes the fetched upstream sandboxes
+func (p *UpdatePlan) Close() {
+	os.RemoveAll(p.upstreamDir)
+}
+
+// compare compares an installed sandbox with the upstream and the recorded version
+// Without a recorded version, local modifications cannot be told apart from upstream changes,
+// so any difference counts as both
+func (p *UpdatePlan) compare(id string) (SandboxUpdate, error) {
+	local := filepath.Join(p.destPath, id)
+	upstream := filepath.Join(p.upstreamDir, id)
+	update := SandboxUpdate{Id: id, UpstreamVersion: sandboxVersion(upstream)}
+
+	if _, err := os.Stat(local); os.IsNotExist(err) {
+		return update, nil
+	}
+	update.Installed = true
+
+	localHash, err := contextHash(local, nil, nil)
+	if err != nil {
+		return update, fmt.Errorf("failed to hash sandbox %s: %v", id, err)
+	}
+	upstreamHash, err := contextHash(upstream, nil, nil)
+	if err != nil {
+		return update, fmt.Errorf("failed to hash upstream sandbox %s: %v", id, err)
+	}
+
+	if entry, ok := p.lock.Sandboxes[id]; ok {
+		update.LocalVersion = entry.Version
+		update.Changed = upstreamHash != entry.Hash
+		update.Modified = localHash != entry.Hash
+	} else {
+		update.LocalVersion = sandboxVersion(local)
+		update.Changed = upstreamHash != localHash
+		update.Modified = update.Changed
+	}
+
+	if update.Changed {
+		update.Files, err = diffFiles(local, upstream)
+		if err != nil {
+			return update, err
+		}
+	}
+	return update, nil
+}
+
+// Overwrite replaces an installed sandbox with its upstream version
+func (p *UpdatePlan) Overwrite(id string) error {
+	return p.install(id, p.upstreamDir)
+}
+
+// Merge merges the local modifications of a sandbox with its upstream changes using git merge-file
+// It returns the files with conflicts, which are written with conflict markers
+func (p *UpdatePlan) Merge(id string) ([]string, error) {
+	local := filepath.Join(p.destPath, id)
+	upstream := filepath.Join(p.upstreamDir, id)
+	base := basePath(p.destPath, id)
+
+	mergedDir, err := os.MkdirTemp("", "sandbox-mcp-merge-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(mergedDir)
+
+	paths := make(map[string]bool)
+	for _, dir := range []string{base, local, upstream} {
+		files, err := fileHashes(dir)
+		if err != nil {
+			return nil, err
+		}
+		for path := range files {
+			paths[path] = true
+		}
+	}
+
+	var conflicts []string
+	for path := range paths {
+		baseFile := readOptional(filepath.Join(base, path))
+		localFile := readOptional(filepath.Join(local, path))
+		upstreamFile := readOptional(filepath.Join(upstream, path))
+
+		var merged []byte
+		switch {
+		case bytes.Equal(localFile, upstreamFile) && (localFile == nil) == (upstreamFile == nil):
+			merged = localFile
+		case bytes.Equal(baseFile, localFile) && (baseFile == nil) == (localFile == nil):
+			// Only changed upstream
+			merged = upstreamFile
+		case bytes.Equal(baseFile, upstreamFile) && (baseFile == nil) == (upstreamFile == nil):
+			// Only changed locally
+			merged = localFile
+		case localFile == nil || upstreamFile == nil:
+			// Removed on one side and changed on the other, keep the changed file
+			conflicts = append(conflicts, path)
+			merged = localFile
+			if merged == nil {
+				merged = upstreamFile
+			}
+		default:
+			var conflicted bool
+			merged, conflicted, err = mergeFile(localFile, baseFile, upstreamFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to merge %s: %v", path, err)
+			}
+			if conflicted {
+				conflicts = append(conflicts, path)
+			}
+		}
+		if merged == nil {
+			continue
+		}
+
+		target := filepath.Join(mergedDir, id, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, merged, fileMode(local, upstream, path)); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(conflicts)
+
+	// The upstream version is the base of the next merge
+	if _, err := copySandboxes(mergedDir, p.destPath, PullOptions{Force: true, Sandboxes: []string{id}, NoDefaults: true}); err != nil {
+		return nil, err
+	}
+	return conflicts, p.record(id)
+}
+
+// UpdateDefaults installs the defaults files of the source if the sandboxes directory has none
+// Installed defaults files are often edited locally, so they are kept if they differ from the source
+// It returns the defaults files that were added (A) or that differ and were kept (M)
+func (p *UpdatePlan) UpdateDefaults(dryRun bool) ([]FileChange, error) {
+	installed := false
+	for _, name := range config.DefaultsFiles() {
+		if _, err := os.Stat(filepath.Join(p.destPath, name)); err == nil {
+			installed = true
+		}
+	}
+
+	var changes []FileChange
+	for _, name := range config.DefaultsFiles() {
+		upstream := readOptional(filepath.Join(p.upstreamDir, name))
+		if upstream == nil {
+			continue
+		}
+		if installed {
+			if local := readOptional(filepath.Join(p.destPath, name)); !bytes.Equal(local, upstream) {
+				changes = append(changes, FileChange{Path: name, Status: "M"})
+			}
+			continue
+		}
+
+		changes = append(changes, FileChange{Path: name, Status: "A"})
+		if dryRun {
+			continue
+		}
+		if err := os.MkdirAll(p.destPath, 0755); err != nil {
+			return nil, err
+		}
+		if err := copyFile(filepath.Join(p.upstreamDir, name), filepath.Join(p.destPath, name), 0644); err != nil {
+			return nil, fmt.Errorf("failed to install defaults file %s: %v", name, err)
+		}
+	}
+	return changes, nil
+}
+
+// Diff writes a unified diff between the installed and the upstream sandbox using git diff
+func (p *UpdatePlan) Diff(id string, w io.Writer) error {
+	cmd := exec.Command("git", "diff", "--no-index", "--no-color",
+		filepath.Join(p.destPath, id), filepath.Join(p.upstreamDir, id))
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	// git diff exits with 1 if there are differences
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return fmt.Errorf("failed to run git diff: %v", err)
+	}
+	return nil
+}
+
+// install installs a sandbox from a directory and records the upstream version
+func (p *UpdatePlan) install(id string, srcPath string) error {
+	if _, err := copySandboxes(srcPath, p.destPath, PullOptions{Force: true, Sandboxes: []string{id}, NoDefaults: true}); err != nil {
+		return err
+	}
+	return p.record(id)
+}
+
+// record records the upstream version of a sandbox in the lockfile
+func (p *UpdatePlan) record(id string) error {
+	if err := p.lock.Record(p.destPath, id, p.source.URL, filepath.Join(p.upstreamDir, id)); err != nil {
+		return err
+	}
+	return p.lock.Save(p.destPath)
+}
+
+// mergeFile runs a three-way merge of a file with git merge-file
+// It returns the merged content and whether it has conflicts
+func mergeFile(local, base, upstream []byte) ([]byte, bool, error) {
+	dir, err := os.MkdirTemp("", "sandbox-mcp-merge-file-")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(dir)
+
+	paths := make([]string, 3)
+	for i, content := range [][]byte{local, base, upstream} {
+		paths[i] = filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(paths[i], content, 0644); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "merge-file", "-p", "-L", "local", "-L", "base", "-L", "upstream", paths[0], paths[1], paths[2])
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// git merge-file exits with the number of conflicts
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return stdout.Bytes(), true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("git merge-file: %v: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), false, nil
+}
+
+// diffFiles lists the files that differ between the installed and the upstream sandbox
+func diffFiles(local, upstream string) ([]FileChange, error) {
+	localFiles, err := fileHashes(local)
+	if err != nil {
+		return nil, err
+	}
+	upstreamFiles, err := fileHashes(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	for path, hash := range upstreamFiles {
+		localHash, ok := localFiles[path]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: path, Status: "A"})
+		case localHash != hash:
+			changes = append(changes, FileChange{Path: path, Status: "M"})
+		}
+	}
+	for path := range localFiles {
+		if _, ok := upstreamFiles[path]; !ok {
+			changes = append(changes, FileChange{Path: path, Status: "D"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// fileHashes returns the hashes of the regular files in a directory by their relative path
+// A missing directory has no files
+func fileHashes(dir string) (map[string][32]byte, error) {
+	hashes := make(map[string][32]byte)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(rel)] = sha256.Sum256(data)
+		return nil
+	})
+	return hashes, err
+}
+
+// readOptional reads a file and returns nil if it does not exist
+func readOptional(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data
+}
+
+// fileMode returns the permissions of the local file, or the upstream file if it does not exist locally
+func fileMode(local, upstream, path string) os.FileMode {
+	for _, dir := range []string{local, upstream} {
+		if info, err := os.Stat(filepath.Join(dir, path)); err == nil {
+			return info.Mode().Perm()
+		}
+	}
+	return 0644
+}
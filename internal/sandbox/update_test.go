@@ -0,0 +1,286 @@
+package sandbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// writeFiles writes files relative to a directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateDetectsLocalModifications(t *testing.T) {
+	upstream := t.TempDir()
+	dest := t.TempDir()
+	source := appconfig.Source{URL: upstream}
+	writeFiles(t, upstream, map[string]string{
+		"shell/config.json":  `{"version": "1.0.0"}`,
+		"python/config.json": `{"version": "1.0.0"}`,
+	})
+	if err := sandbox.PullSource(dest, source, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFiles(t, upstream, map[string]string{
+		"shell/config.json":  `{"version": "2.0.0"}`,
+		"python/config.json": `{"version": "2.0.0"}`,
+	})
+	writeFiles(t, dest, map[string]string{"python/local.txt": "mine"})
+
+	plan, err := sandbox.PlanUpdate(dest, source, sandbox.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plan.Close()
+
+	updates := make(map[string]sandbox.SandboxUpdate)
+	for _, update := range plan.Updates {
+		updates[update.Id] = update
+	}
+	if u := updates["shell"]; !u.Changed || u.Modified || u.LocalVersion != "1.0.0" || u.UpstreamVersion != "2.0.0" {
+		t.Errorf("expected shell to be changed upstream only, got %+v", u)
+	}
+	if u := updates["python"]; !u.Changed || !u.Modified {
+		t.Errorf("expected python to be changed upstream and locally, got %+v", u)
+	}
+
+	// Overwriting records the upstream version
+	if err := plan.Overwrite("shell"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lock, err := sandbox.LoadLockfile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := lock.Sandboxes["shell"].Version; v != "2.0.0" {
+		t.Errorf("expected version 2.0.0 in the lockfile, got %q", v)
+	}
+
+	// Merging keeps the local files
+	if _, err := plan.Merge("python"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "python", "local.txt")); string(data) != "mine" {
+		t.Errorf("expected local file to be kept, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "python", "config.json")); string(data) != `{"version": "2.0.0"}` {
+		t.Errorf("expected upstream config, got %q", data)
+	}
+}
+
+func TestUpdatePlansSandboxesAgainstTheirSource(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	dest := t.TempDir()
+	writeFiles(t, first, map[string]string{"shell/config.json": `{"version": "1.0.0"}`})
+	writeFiles(t, second, map[string]string{
+		"shell/config.json":  `{"version": "9.0.0"}`,
+		"python/config.json": `{"version": "1.0.0"}`,
+	})
+	if err := sandbox.PullSource(dest, appconfig.Source{URL: first}, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     sandbox.UpdateOptions
+		expected []string
+	}{
+		{name: "own source", expected: []string{"python"}},
+		{name: "any source", opts: sandbox.UpdateOptions{AnySource: true}, expected: []string{"python", "shell"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := sandbox.PlanUpdate(dest, appconfig.Source{URL: second}, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer plan.Close()
+
+			var ids []string
+			for _, update := range plan.Updates {
+				ids = append(ids, update.Id)
+			}
+			if !slices.Equal(ids, tt.expected) {
+				t.Errorf("expected updates for %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestUpdateOverwritesLocalModifications(t *testing.T) {
+	upstream := t.TempDir()
+	dest := t.TempDir()
+	source := appconfig.Source{URL: upstream}
+	writeFiles(t, upstream, map[string]string{"shell/main.sh": "echo 1\n"})
+	if err := sandbox.PullSource(dest, source, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writeFiles(t, upstream, map[string]string{"shell/main.sh": "echo 2\n"})
+	writeFiles(t, dest, map[string]string{"shell/main.sh": "echo local\n"})
+
+	plan, err := sandbox.PlanUpdate(dest, source, sandbox.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plan.Close()
+
+	if len(plan.Updates) != 1 || !plan.Updates[0].Changed || !plan.Updates[0].Modified {
+		t.Fatalf("expected shell to be changed upstream and locally, got %+v", plan.Updates)
+	}
+	if err := plan.Overwrite("shell"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "shell", "main.sh")); string(data) != "echo 2\n" {
+		t.Errorf("expected the upstream file, got %q", data)
+	}
+
+	// The overwritten sandbox is up to date
+	again, err := sandbox.PlanUpdate(dest, source, sandbox.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer again.Close()
+	if u := again.Updates[0]; u.Changed || u.Modified {
+		t.Errorf("expected shell to be up to date, got %+v", u)
+	}
+}
+
+func TestUpdateMergeReportsConflicts(t *testing.T) {
+	upstream := t.TempDir()
+	dest := t.TempDir()
+	source := appconfig.Source{URL: upstream}
+	writeFiles(t, upstream, map[string]string{
+		"shell/main.sh":   "echo 1\n",
+		"shell/README.md": "shell\n",
+	})
+	if err := sandbox.PullSource(dest, source, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writeFiles(t, upstream, map[string]string{
+		"shell/main.sh":   "echo upstream\n",
+		"shell/README.md": "shell sandbox\n",
+	})
+	writeFiles(t, dest, map[string]string{"shell/main.sh": "echo local\n"})
+
+	plan, err := sandbox.PlanUpdate(dest, source, sandbox.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plan.Close()
+
+	conflicts, err := plan.Merge("shell")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(conflicts, []string{"main.sh"}) {
+		t.Errorf("expected a conflict in main.sh, got %v", conflicts)
+	}
+	data, _ := os.ReadFile(filepath.Join(dest, "shell", "main.sh"))
+	for _, marker := range []string{"<<<<<<< local", "echo local", "echo upstream", ">>>>>>> upstream"} {
+		if !strings.Contains(string(data), marker) {
+			t.Errorf("expected %q in the merged file, got %q", marker, data)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "shell", "README.md")); string(data) != "shell sandbox\n" {
+		t.Errorf("expected the upstream change without a conflict, got %q", data)
+	}
+}
+
+func TestUpdateWithoutLockEntry(t *testing.T) {
+	upstream := t.TempDir()
+	dest := t.TempDir()
+	source := appconfig.Source{URL: upstream}
+	writeFiles(t, upstream, map[string]string{"shell/config.json": `{"version": "2.0.0"}`})
+
+	// A sandbox copied by hand has no recorded version
+	writeFiles(t, dest, map[string]string{"shell/config.json": `{"version": "1.0.0"}`})
+
+	plan, err := sandbox.PlanUpdate(dest, source, sandbox.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plan.Close()
+
+	if len(plan.Updates) != 1 {
+		t.Fatalf("expected one update, got %+v", plan.Updates)
+	}
+	u := plan.Updates[0]
+	if !u.Installed || !u.Changed || !u.Modified || u.LocalVersion != "1.0.0" || u.UpstreamVersion != "2.0.0" {
+		t.Errorf("expected shell to count as changed upstream and locally, got %+v", u)
+	}
+
+	// Overwriting records the sandbox in the lockfile
+	if err := plan.Overwrite("shell"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lock, err := sandbox.LoadLockfile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := lock.Sandboxes["shell"]; entry.Version != "2.0.0" || entry.Source != upstream {
+		t.Errorf("expected the upstream version in the lockfile, got %+v", entry)
+	}
+}
+
+func TestUpdateDefaults(t *testing.T) {
+	upstream := t.TempDir()
+	dest := t.TempDir()
+	source := appconfig.Source{URL: upstream}
+	writeFiles(t, upstream, map[string]string{"shell/config.json": `{"version": "1.0.0"}`})
+	if err := sandbox.PullSource(dest, source, sandbox.PullOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A defaults file added upstream is installed
+	writeFiles(t, upstream, map[string]string{"defaults.json": `{"user": "sandbox"}`, "shell/config.json": `{"version": "2.0.0"}`})
+	plan, err := sandbox.PlanUpdate(dest, source, sandbox.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer plan.Close()
+
+	if changes, err := plan.UpdateDefaults(true); err != nil || len(changes) != 1 || changes[0].Status != "A" {
+		t.Fatalf("expected the defaults file to be added upstream, got %+v, %v", changes, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "defaults.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected a dry run not to install the defaults file, got %v", err)
+	}
+	if _, err := plan.UpdateDefaults(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "defaults.json")); string(data) != `{"user": "sandbox"}` {
+		t.Errorf("expected the defaults file to be installed, got %q", data)
+	}
+
+	// Updating a sandbox does not touch the defaults file
+	writeFiles(t, dest, map[string]string{"defaults.json": `{"user": "me"}`})
+	if err := plan.Overwrite("shell"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A locally changed defaults file is kept
+	changes, err := plan.UpdateDefaults(false)
+	if err != nil || len(changes) != 1 || changes[0].Status != "M" {
+		t.Fatalf("expected the defaults file to differ, got %+v, %v", changes, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "defaults.json")); string(data) != `{"user": "me"}` {
+		t.Errorf("expected the local defaults file to be kept, got %q", data)
+	}
+}
@@ -0,0 +1,113 @@
+package scaffold
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"text/template"
+)
+
+// DefaultTemplate is the template used when none is given
+const DefaultTemplate = "shell"
+
+// templates has a directory for each template with the files of a new sandbox
+// The files are text/template templates that get the Data of the sandbox
+//
+//go:embed templates
+var templates embed.FS
+
+// idPattern restricts the sandbox ids to names that are safe as directory, image and tool names
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Data is passed to the templates
+type Data struct {
+	Id   string
+	Name string
+}
+
+// Templates returns the names of the available templates
+func Templates() []string {
+	entries, _ := fs.ReadDir(templates, "templates")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create creates a new sandbox in dir from a template
+// It fails if dir already exists, so that existing sandboxes are never overwritten
+func Create(dir string, templateName string, data Data) error {
+	if !idPattern.MatchString(data.Id) {
+		return fmt.Errorf("invalid sandbox id %q: use lowercase letters, digits, '-' and '_'", data.Id)
+	}
+	if data.Name == "" {
+		data.Name = data.Id
+	}
+
+	// Only the template directories can be copied, not "" or ".." which would copy all the templates
+	if !slices.Contains(Templates(), templateName) {
+		return fmt.Errorf("unknown template %q, available templates: %v", templateName, Templates())
+	}
+	root := path.Join("templates", templateName)
+
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("%s already exists", dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	funcs := template.FuncMap{"json": toJSON}
+	err := fs.WalkDir(templates, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		tmpl, err := template.New(entry.Name()).Funcs(funcs).ParseFS(templates, name)
+		if err != nil {
+			return fmt.Errorf("failed to parse template %s: %v", name, err)
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(file, data); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to render %s: %v", rel, err)
+		}
+		return file.Close()
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// toJSON renders a value as JSON to safely embed strings in the templates
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
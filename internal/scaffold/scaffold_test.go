@@ -0,0 +1,67 @@
+package scaffold_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/scaffold"
+	"github.com/pottekkat/sandbox-mcp/internal/testrunner"
+)
+
+func TestTemplatesAreValidAndSecure(t *testing.T) {
+	for _, name := range scaffold.Templates() {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "my-sandbox")
+			if err := scaffold.Create(dir, name, scaffold.Data{Id: "my-sandbox", Name: `My "sandbox"`}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cfg, err := config.LoadSandboxConfig(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Id != "my-sandbox" || cfg.Name() != `My "sandbox"` || cfg.Image != "sandbox-mcp/my-sandbox:latest" {
+				t.Errorf("unexpected id, name or image: %q, %q, %q", cfg.Id, cfg.Name(), cfg.Image)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("expected a valid configuration, got %v", err)
+			}
+			if warnings := cfg.SecurityWarnings(); len(warnings) > 0 {
+				t.Errorf("expected secure defaults, got %v", warnings)
+			}
+
+			suites, err := testrunner.LoadSandboxSuites(map[string]*config.SandboxConfig{cfg.Id: cfg}, cfg.Id)
+			if err != nil || len(suites) == 0 {
+				t.Errorf("expected a sample test case, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateRejectsInvalidIdsAndExistingDirectories(t *testing.T) {
+	parent := t.TempDir()
+	if err := scaffold.Create(filepath.Join(parent, "x"), scaffold.DefaultTemplate, scaffold.Data{Id: "../x"}); err == nil {
+		t.Error("expected an error for an invalid id")
+	}
+	if err := scaffold.Create(parent, scaffold.DefaultTemplate, scaffold.Data{Id: "x"}); err == nil {
+		t.Error("expected an error for an existing directory")
+	}
+}
+
+func TestCreateRejectsUnknownTemplates(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "shell/..", "missing"} {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "x")
+			err := scaffold.Create(dir, name, scaffold.Data{Id: "x"})
+			if err == nil || !strings.Contains(err.Error(), "unknown template") {
+				t.Errorf("expected an unknown template error, got %v", err)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("expected no sandbox to be created, got %v", err)
+			}
+		})
+	}
+}
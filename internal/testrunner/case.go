@@ -0,0 +1,120 @@
+package testrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+)
+
+// sandboxTestsDir is the directory in a sandbox that stores its test cases
+const sandboxTestsDir = "tests"
+
+// Case is a test case that calls a sandbox tool and checks the response
+type Case struct {
+	Name     string         `json:"name,omitempty"`
+	Request  map[string]any `json:"request"`
+	Response Expectation    `json:"response"`
+}
+
+// Expectation describes the expected response of a tool call
+// All the set expectations must be met for a case to pass
+type Expectation struct {
+	// Text must be a substring of the response text
+	Text string `json:"text,omitempty"`
+	// Contains are substrings that must all be in the response text
+	Contains []string `json:"contains,omitempty"`
+	// Regex must match the response text
+	Regex string `json:"regex,omitempty"`
+	// IsError is whether the response is an error, defaults to false
+	IsError bool `json:"isError,omitempty"`
+	// ExitCode is the exit code of the command in the sandbox
+	ExitCode *int `json:"exitCode,omitempty"`
+	// JSONPath maps paths like $.message in the response text parsed as JSON to their values
+	JSONPath map[string]any `json:"jsonPath,omitempty"`
+}
+
+// Suite is a set of test cases for a single tool
+type Suite struct {
+	Tool  string
+	File  string
+	Cases []Case
+}
+
+// LoadSuite loads the test cases from a JSON file
+func LoadSuite(tool string, path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test file %s: %v", path, err)
+	}
+
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("failed to parse test file %s: %v", path, err)
+	}
+
+	return &Suite{Tool: tool, File: path, Cases: cases}, nil
+}
+
+// LoadSuites loads the test cases from the JSON files in a directory
+// Each file is named after the tool it tests, like python.json
+// If tool is not empty, only the suite of that tool is loaded
+func LoadSuites(dir string, tool string) ([]*Suite, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find test files: %v", err)
+	}
+	sort.Strings(paths)
+
+	var suites []*Suite
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if tool != "" && name != tool {
+			continue
+		}
+
+		suite, err := LoadSuite(name, path)
+		if err != nil {
+			return nil, err
+		}
+		suites = append(suites, suite)
+	}
+
+	return suites, nil
+}
+
+// LoadSandboxSuites loads the test cases in the tests directory of each sandbox
+// Each JSON file in the directory is a suite for the tool of the sandbox
+// If id is not empty, only the suites of that sandbox are loaded
+func LoadSandboxSuites(configs map[string]*config.SandboxConfig, id string) ([]*Suite, error) {
+	ids := make([]string, 0, len(configs))
+	for sandboxId := range configs {
+		if id == "" || sandboxId == id {
+			ids = append(ids, sandboxId)
+		}
+	}
+	sort.Strings(ids)
+
+	var suites []*Suite
+	for _, sandboxId := range ids {
+		paths, err := filepath.Glob(filepath.Join(configs[sandboxId].Dir, sandboxTestsDir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find test files: %v", err)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			suite, err := LoadSuite(sandboxId, path)
+			if err != nil {
+				return nil, err
+			}
+			suites = append(suites, suite)
+		}
+	}
+
+	return suites, nil
+}
@@ -0,0 +1,146 @@
+package testrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pottekkat/sandbox-mcp/internal/sandbox"
+)
+
+// Check compares a tool result with the expectation and returns the failures
+func Check(expectation Expectation, result *mcp.CallToolResult) []string {
+	var failures []string
+	text := ResultText(result)
+
+	if result.IsError != expectation.IsError {
+		failures = append(failures, fmt.Sprintf("error flag mismatch: expected=%t, actual=%t", expectation.IsError, result.IsError))
+	}
+
+	if expectation.Text != "" && !strings.Contains(text, expectation.Text) {
+		failures = append(failures, fmt.Sprintf("expected text %q in %q", expectation.Text, text))
+	}
+
+	for _, substring := range expectation.Contains {
+		if !strings.Contains(text, substring) {
+			failures = append(failures, fmt.Sprintf("expected text %q in %q", substring, text))
+		}
+	}
+
+	if expectation.Regex != "" {
+		re, err := regexp.Compile(expectation.Regex)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid regex %q: %v", expectation.Regex, err))
+		} else if !re.MatchString(text) {
+			failures = append(failures, fmt.Sprintf("expected text matching %q in %q", expectation.Regex, text))
+		}
+	}
+
+	if expectation.ExitCode != nil {
+		if exitCode := sandbox.ExitCode(result); exitCode != *expectation.ExitCode {
+			failures = append(failures, fmt.Sprintf("exit code mismatch: expected=%d, actual=%d", *expectation.ExitCode, exitCode))
+		}
+	}
+
+	if len(expectation.JSONPath) > 0 {
+		var document any
+		if err := json.Unmarshal([]byte(text), &document); err != nil {
+			failures = append(failures, fmt.Sprintf("response is not valid JSON: %v", err))
+			return failures
+		}
+		for path, expected := range expectation.JSONPath {
+			actual, err := evalJSONPath(document, path)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("JSON path %s: %v", path, err))
+				continue
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				failures = append(failures, fmt.Sprintf("JSON path %s mismatch: expected=%v, actual=%v", path, expected, actual))
+			}
+		}
+	}
+
+	return failures
+}
+
+// ResultText joins the text contents of a tool result
+func ResultText(result *mcp.CallToolResult) string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, strings.ReplaceAll(text.Text, "\r", ""))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// evalJSONPath returns the value at a path like $.routes[0].uri in a decoded JSON document
+// Only object keys (.key or ["key"]) and array indices ([0]) are supported
+func evalJSONPath(document any, path string) (any, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+	rest := path[1:]
+	current := document
+
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+
+			object, ok := current.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot get key %q of a non-object", key)
+			}
+			if current, ok = object[key]; !ok {
+				return nil, fmt.Errorf("key %q not found", key)
+			}
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed bracket")
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+
+			// Quoted selectors are object keys
+			if key, err := strconv.Unquote(selector); err == nil {
+				object, ok := current.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("cannot get key %q of a non-object", key)
+				}
+				if current, ok = object[key]; !ok {
+					return nil, fmt.Errorf("key %q not found", key)
+				}
+				continue
+			}
+
+			index, err := strconv.Atoi(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector %q", selector)
+			}
+			array, ok := current.([]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot get index %d of a non-array", index)
+			}
+			if index < 0 || index >= len(array) {
+				return nil, fmt.Errorf("index %d out of range", index)
+			}
+			current = array[index]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest)
+		}
+	}
+
+	return current, nil
+}
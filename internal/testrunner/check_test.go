@@ -0,0 +1,78 @@
+package testrunner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestCheck(t *testing.T) {
+	textResult := mcp.NewToolResultText("Hello from Python!\n")
+	jsonResult := mcp.NewToolResultText(`{"message":"Hello from APISIX!","routes":[{"uri":"/ip","priority":1}]}`)
+	errorResult := mcp.NewToolResultError("ZeroDivisionError: division by zero")
+	errorResult.Meta = map[string]any{"exitCode": float64(1)}
+
+	tests := []struct {
+		name        string
+		expectation Expectation
+		result      *mcp.CallToolResult
+		failures    int
+	}{
+		{"substring", Expectation{Text: "Hello"}, textResult, 0},
+		{"missing substring", Expectation{Text: "Goodbye"}, textResult, 1},
+		{"contains", Expectation{Contains: []string{"Hello", "Python"}}, textResult, 0},
+		{"regex", Expectation{Regex: `^Hello from \w+!`}, textResult, 0},
+		{"regex mismatch", Expectation{Regex: `^Python`}, textResult, 1},
+		{"error flag", Expectation{Text: "ZeroDivisionError", IsError: true}, errorResult, 0},
+		{"error flag mismatch", Expectation{Text: "ZeroDivisionError"}, errorResult, 1},
+		{"exit code", Expectation{IsError: true, ExitCode: intPtr(1)}, errorResult, 0},
+		{"exit code mismatch", Expectation{ExitCode: intPtr(1)}, textResult, 1},
+		{"json path", Expectation{JSONPath: map[string]any{
+			"$.message":               "Hello from APISIX!",
+			"$.routes[0].uri":         "/ip",
+			`$["routes"][0].priority`: float64(1),
+		}}, jsonResult, 0},
+		{"json path mismatch", Expectation{JSONPath: map[string]any{"$.routes[1].uri": "/ip"}}, jsonResult, 1},
+		{"json path on text", Expectation{JSONPath: map[string]any{"$.message": "Hello"}}, textResult, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := Check(tt.expectation, tt.result)
+			if len(failures) != tt.failures {
+				t.Errorf("expected %d failures, got %d: %v", tt.failures, len(failures), failures)
+			}
+		})
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	results := []Result{
+		{Suite: "python", Index: 0},
+		{Suite: "python", Index: 1, Failures: []string{"expected text \"a\" in \"b\""}},
+		{Suite: "rust", Index: 0, Skipped: "tool rust does not exist on the server"},
+	}
+
+	var b bytes.Buffer
+	if err := WriteJUnit(&b, results); err != nil {
+		t.Fatal(err)
+	}
+
+	report := b.String()
+	for _, want := range []string{
+		`<testsuites tests="3" failures="1" skipped="1"`,
+		`<testsuite name="python" tests="2" failures="1" skipped="0"`,
+		`<testcase name="case 2" classname="python"`,
+		`<skipped message="tool rust does not exist on the server">`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in report:\n%s", want, report)
+		}
+	}
+}
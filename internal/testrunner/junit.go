@@ -0,0 +1,99 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the test cases of a single tool
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a single test case
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+// junitFailure describes why a test case failed
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSkipped describes why a test case was skipped
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the results as a JUnit XML report with a test suite per tool
+func WriteJUnit(w io.Writer, results []Result) error {
+	report := junitTestSuites{}
+	index := make(map[string]int)
+
+	for _, result := range results {
+		i, ok := index[result.Suite]
+		if !ok {
+			i = len(report.Suites)
+			index[result.Suite] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: result.Suite})
+		}
+		suite := &report.Suites[i]
+
+		testCase := junitTestCase{
+			Name:      result.Name(),
+			ClassName: result.Suite,
+			Time:      result.Duration.Seconds(),
+		}
+		switch {
+		case result.Skipped != "":
+			testCase.Skipped = &junitSkipped{Message: result.Skipped}
+			suite.Skipped++
+			report.Skipped++
+		case len(result.Failures) > 0:
+			testCase.Failure = &junitFailure{
+				Message: result.Failures[0],
+				Text:    strings.Join(result.Failures, "\n"),
+			}
+			suite.Failures++
+			report.Failures++
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+		suite.Time += testCase.Time
+		report.Tests++
+		report.Time += testCase.Time
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
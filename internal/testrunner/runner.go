@@ -0,0 +1,138 @@
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Result is the outcome of a single test case
+type Result struct {
+	Suite    string
+	File     string
+	Index    int
+	Case     Case
+	Duration time.Duration
+	Failures []string
+	// Skipped is the reason the case was skipped, if it was
+	Skipped string
+}
+
+// Name returns a readable name for the test case
+func (r *Result) Name() string {
+	if r.Case.Name != "" {
+		return r.Case.Name
+	}
+	return fmt.Sprintf("case %d", r.Index+1)
+}
+
+// Passed returns true if the case ran and met all expectations
+func (r *Result) Passed() bool {
+	return r.Skipped == "" && len(r.Failures) == 0
+}
+
+// Runner runs test cases against an MCP server through an MCP client
+type Runner struct {
+	Client *client.Client
+	// Parallel is the number of cases that run at the same time
+	Parallel int
+}
+
+// NewInProcessRunner creates a runner with an initialized client that calls the server in the same process
+func NewInProcessRunner(ctx context.Context, s *server.MCPServer, parallel int) (*Runner, error) {
+	c, err := client.NewInProcessClient(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %v", err)
+	}
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "sandbox-mcp-test",
+		Version: "0.1.0",
+	}
+	if _, err := c.Initialize(ctx, initRequest); err != nil {
+		return nil, fmt.Errorf("failed to initialize client: %v", err)
+	}
+
+	return &Runner{Client: c, Parallel: parallel}, nil
+}
+
+// Run runs the cases of the suites and returns the results in the same order
+// Cases of tools that the server does not have are skipped
+func (r *Runner) Run(ctx context.Context, suites []*Suite) ([]Result, error) {
+	tools, err := r.Client.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tools: %v", err)
+	}
+	available := make(map[string]bool)
+	for _, tool := range tools.Tools {
+		available[tool.Name] = true
+	}
+
+	var results []Result
+	for _, suite := range suites {
+		for i, c := range suite.Cases {
+			result := Result{Suite: suite.Tool, File: suite.File, Index: i, Case: c}
+			if !available[suite.Tool] {
+				result.Skipped = fmt.Sprintf("tool %s does not exist on the server", suite.Tool)
+			}
+			results = append(results, result)
+		}
+	}
+
+	parallel := r.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	slots := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i := range results {
+		if results[i].Skipped != "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				results[i].Failures = []string{ctx.Err().Error()}
+				return
+			}
+
+			r.runCase(ctx, &results[i])
+		}()
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// runCase calls the tool of a test case and checks the response
+func (r *Runner) runCase(ctx context.Context, result *Result) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = result.Suite
+	request.Params.Arguments = result.Case.Request
+
+	start := time.Now()
+	response, err := r.Client.CallTool(ctx, request)
+	result.Duration = time.Since(start)
+
+	// Errors returned by the handler are treated as error responses
+	// so that expectations can match their messages
+	if err != nil {
+		response = mcp.NewToolResultError(err.Error())
+	}
+
+	result.Failures = Check(result.Case.Response, response)
+}
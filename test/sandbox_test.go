@@ -0,0 +1,89 @@
+package test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/pottekkat/sandbox-mcp/internal/appconfig"
+	"github.com/pottekkat/sandbox-mcp/internal/config"
+	"github.com/pottekkat/sandbox-mcp/internal/mcpserver"
+	"github.com/pottekkat/sandbox-mcp/internal/testrunner"
+)
+
+var (
+	sandboxesPath = flag.String("sandboxes", "../sandboxes", "Directory to load the sandboxes from")
+	tool          = flag.String("tool", "", "Only run the tests of this tool")
+	parallel      = flag.Int("parallel", 4, "Number of test cases that run at the same time")
+	junit         = flag.String("junit", "", "Write a JUnit XML report to this file")
+)
+
+// dockerAvailable returns true if the Docker daemon can be reached
+func dockerAvailable(ctx context.Context) bool {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return false
+	}
+	defer cli.Close()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = cli.Ping(pingCtx)
+	return err == nil
+}
+
+// TestSandboxes runs the cases in test_files against the sandbox tools
+// The tools are called in-process through an MCP client, so the sandbox images must be built
+func TestSandboxes(t *testing.T) {
+	ctx := context.Background()
+	if !dockerAvailable(ctx) {
+		t.Skip("Docker is not available")
+	}
+
+	configs, err := config.LoadSandboxConfigs(*sandboxesPath)
+	if err != nil {
+		t.Fatalf("Failed to load sandbox configurations: %v", err)
+	}
+
+	suites, err := testrunner.LoadSuites("test_files", *tool)
+	if err != nil {
+		t.Fatalf("Failed to load test files: %v", err)
+	}
+
+	s := mcpserver.New(&appconfig.Config{ToolMode: appconfig.ToolModeSandbox}, configs)
+	runner, err := testrunner.NewInProcessRunner(ctx, s, *parallel)
+	if err != nil {
+		t.Fatalf("Failed to create test runner: %v", err)
+	}
+
+	results, err := runner.Run(ctx, suites)
+	if err != nil {
+		t.Fatalf("Failed to run tests: %v", err)
+	}
+
+	for _, result := range results {
+		t.Run(result.Suite+"/"+result.Name(), func(t *testing.T) {
+			if result.Skipped != "" {
+				t.Skip(result.Skipped)
+			}
+			for _, failure := range result.Failures {
+				t.Error(failure)
+			}
+		})
+	}
+
+	if *junit != "" {
+		file, err := os.Create(*junit)
+		if err != nil {
+			t.Fatalf("Failed to create JUnit report: %v", err)
+		}
+		defer file.Close()
+
+		if err := testrunner.WriteJUnit(file, results); err != nil {
+			t.Fatalf("Failed to write JUnit report: %v", err)
+		}
+	}
+}